@@ -0,0 +1,24 @@
+package core
+
+// An AggregationStrategy merges the exchanges produced by sending one
+// exchange to more than one place back into a single exchange.
+type AggregationStrategy interface {
+	// Aggregate merges the new exchange into the result aggregated so
+	// far and returns the new result. The old exchange is nil when the
+	// first exchange is aggregated.
+	Aggregate(oldExchange Exchange, newExchange Exchange) Exchange
+}
+
+// AggregationFunction allows a plain function to be used as an
+// AggregationStrategy.
+type AggregationFunction func(oldExchange Exchange, newExchange Exchange) Exchange
+
+func (a AggregationFunction) Aggregate(oldExchange Exchange, newExchange Exchange) Exchange {
+	return a(oldExchange, newExchange)
+}
+
+// UseLatest is the AggregationStrategy that keeps the most recent exchange
+// and discards the others.
+var UseLatest AggregationStrategy = AggregationFunction(func(oldExchange Exchange, newExchange Exchange) Exchange {
+	return newExchange
+})
@@ -0,0 +1,434 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a CircuitBreaker block.
+type CircuitState int
+
+const (
+	// CircuitClosed lets every exchange through and records the outcome.
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen rejects every exchange until the open duration passes.
+	CircuitOpen
+
+	// CircuitHalfOpen lets a limited number of exchanges through to
+	// decide whether to close or open the circuit again.
+	CircuitHalfOpen
+)
+
+func (c CircuitState) String() string {
+	switch c {
+	case CircuitClosed:
+		return "Closed"
+	case CircuitOpen:
+		return "Open"
+	case CircuitHalfOpen:
+		return "HalfOpen"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(c))
+}
+
+const (
+	// CircuitStateProperty is the exchange property set to the state of
+	// the circuit when the exchange arrived at a CircuitBreaker block.
+	CircuitStateProperty = "CircuitState"
+
+	// CircuitFallbackProperty is the exchange property set to true when
+	// the fallback of a CircuitBreaker block was run for the exchange.
+	CircuitFallbackProperty = "CircuitFallback"
+)
+
+// CircuitOpenError is the error set on an exchange that is rejected by an
+// open circuit when there is no fallback.
+type CircuitOpenError struct {
+}
+
+func (c CircuitOpenError) Error() string {
+	return fmt.Sprint("The circuit is open")
+}
+
+// CircuitTimeoutError is the error set on an exchange when the steps of a
+// CircuitBreaker block take longer than the timeout.
+type CircuitTimeoutError struct {
+	Timeout time.Duration
+}
+
+func (c CircuitTimeoutError) Error() string {
+	return fmt.Sprintf("The call did not complete within %s", c.Timeout)
+}
+
+// CircuitMetrics are the rates over the sliding window of a CircuitBreaker
+// block when its state changed.
+type CircuitMetrics struct {
+	Calls       int
+	FailedCalls int
+	SlowCalls   int
+	FailureRate float64
+	SlowRate    float64
+}
+
+// A CircuitEvent describes a change in the state of a CircuitBreaker block.
+type CircuitEvent struct {
+	From    CircuitState
+	To      CircuitState
+	Metrics CircuitMetrics
+}
+
+// CircuitBreakerOptions configure a CircuitBreaker block. Rates are
+// percentages between 0 and 100.
+type CircuitBreakerOptions struct {
+	// WindowSize is the number of most recent calls the rates are
+	// calculated over.
+	WindowSize int
+
+	// MinimumCalls is the number of calls that must be in the window
+	// before the rates can open the circuit.
+	MinimumCalls int
+
+	// FailureRateThreshold opens the circuit when the percentage of
+	// failed calls is at or above it.
+	FailureRateThreshold float64
+
+	// SlowCallDuration is how long a call can take before it is slow.
+	SlowCallDuration time.Duration
+
+	// SlowCallRateThreshold opens the circuit when the percentage of slow
+	// calls is at or above it.
+	SlowCallRateThreshold float64
+
+	// Timeout fails a call that takes longer than it. The steps are run
+	// on another goroutine against a copy of the exchange when a timeout
+	// is set. A call that finishes in time moves the completion callbacks
+	// and transaction work of its steps to the exchange. A call that times
+	// out is failed with CircuitTimeoutError so that none of its remaining
+	// steps run, and its completion callbacks, such as the rollback of a
+	// Transacted block inside the breaker, see that failure once its
+	// current step returns. Zero means there is no timeout.
+	Timeout time.Duration
+
+	// OpenDuration is how long the circuit stays open before letting
+	// calls through again in the half open state.
+	OpenDuration time.Duration
+
+	// HalfOpenCalls is the number of calls let through in the half open
+	// state to decide whether to close the circuit.
+	HalfOpenCalls int
+
+	// OnStateChange is called with every change of state.
+	OnStateChange func(event CircuitEvent)
+}
+
+const (
+	DefaultCircuitWindowSize       = 100
+	DefaultCircuitMinimumCalls     = 10
+	DefaultCircuitFailureRate      = 50
+	DefaultCircuitSlowCallDuration = time.Minute
+	DefaultCircuitSlowCallRate     = 100
+	DefaultCircuitOpenDuration     = time.Minute
+	DefaultCircuitHalfOpenCalls    = 10
+)
+
+// the outcome of a single call in the sliding window
+type circuitOutcome struct {
+	failed bool
+	slow   bool
+}
+
+// circuitBreaker is the block opened by RouteConfiguration.CircuitBreaker.
+// The steps added after OnFallback make up the fallback that is run when
+// the circuit is open or a call fails.
+type circuitBreaker struct {
+	options    CircuitBreakerOptions
+	processors pipeline
+	fallback   pipeline
+	inFallback bool
+
+	lock     sync.Mutex
+	state    CircuitState
+	window   []circuitOutcome
+	next     int
+	openedAt time.Time
+	trial    int
+	outcomes []circuitOutcome
+	now      func() time.Time
+
+	// period counts the changes of state so that the outcome of a call is
+	// only recorded in the state that it was let through in
+	period uint64
+}
+
+func newCircuitBreaker(options CircuitBreakerOptions) *circuitBreaker {
+	if options.WindowSize <= 0 {
+		options.WindowSize = DefaultCircuitWindowSize
+	}
+	if options.MinimumCalls <= 0 {
+		options.MinimumCalls = DefaultCircuitMinimumCalls
+	}
+	if options.FailureRateThreshold <= 0 {
+		options.FailureRateThreshold = DefaultCircuitFailureRate
+	}
+	if options.SlowCallDuration <= 0 {
+		options.SlowCallDuration = DefaultCircuitSlowCallDuration
+	}
+	if options.SlowCallRateThreshold <= 0 {
+		options.SlowCallRateThreshold = DefaultCircuitSlowCallRate
+	}
+	if options.OpenDuration <= 0 {
+		options.OpenDuration = DefaultCircuitOpenDuration
+	}
+	if options.HalfOpenCalls <= 0 {
+		options.HalfOpenCalls = DefaultCircuitHalfOpenCalls
+	}
+	return &circuitBreaker{
+		options:    options,
+		processors: make(pipeline, 0),
+		fallback:   make(pipeline, 0),
+		window:     make([]circuitOutcome, 0, options.WindowSize),
+		now:        time.Now,
+	}
+}
+
+func (c *circuitBreaker) add(processor Processor) {
+	if c.inFallback {
+		c.fallback = append(c.fallback, processor)
+		return
+	}
+	c.processors = append(c.processors, processor)
+}
+
+func (c *circuitBreaker) Process(exchange Exchange) {
+	state, period, permitted := c.acquire()
+	exchange.Properties()[CircuitStateProperty] = state
+	if !permitted {
+		c.runFallback(exchange, CircuitOpenError{})
+		return
+	}
+
+	start := c.now()
+	c.call(exchange)
+	c.record(period, circuitOutcome{
+		failed: exchange.Error() != nil,
+		slow:   c.now().Sub(start) >= c.options.SlowCallDuration,
+	})
+	if exchange.Error() != nil {
+		c.runFallback(exchange, exchange.Error())
+	}
+}
+
+// call runs the steps of the block, on another goroutine against a copy of
+// the exchange if there is a timeout. The exchange is held until the copy
+// has finished so that the callbacks of a call that finished in time are
+// moved to the exchange, while those of a call that timed out are run
+// against the copy with the timeout as its error.
+func (c *circuitBreaker) call(exchange Exchange) {
+	if c.options.Timeout <= 0 {
+		c.processors.Process(exchange)
+		return
+	}
+
+	attempt := exchange.copy()
+	attempt.Out(CopyMessage(exchange.In()))
+	attempt.rotate()
+	release := exchange.hold()
+	done := make(chan struct{})
+	timedOut := make(chan struct{})
+	// whichever of the attempt and the timeout sees the other one last
+	// completes the attempt that timed out
+	var abandon sync.Once
+	abandoned := func() {
+		abandon.Do(func() {
+			attempt.complete()
+			release(nil)
+		})
+	}
+	go func() {
+		c.processors.Process(attempt)
+		close(done)
+		select {
+		case <-timedOut:
+			abandoned()
+		default:
+		}
+	}()
+
+	timer := time.NewTimer(c.options.Timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		for key, value := range attempt.Properties() {
+			exchange.Properties()[key] = value
+		}
+		exchange.Out(attempt.In())
+		exchange.SetError(attempt.Error())
+		// the error was moved already and the fallback may still clear it
+		attempt.SetError(nil)
+		release(attempt)
+	case <-timer.C:
+		err := CircuitTimeoutError{Timeout: c.options.Timeout}
+		// stop the remaining steps of the attempt at the next step
+		attempt.SetError(err)
+		exchange.SetError(err)
+		close(timedOut)
+		select {
+		case <-done:
+			abandoned()
+		default:
+		}
+	}
+}
+
+// runFallback replaces the error with the result of the fallback, if there
+// is one, or sets the error on the exchange if there is not
+func (c *circuitBreaker) runFallback(exchange Exchange, err error) {
+	if len(c.fallback) == 0 {
+		exchange.SetError(err)
+		return
+	}
+	exchange.SetError(nil)
+	exchange.Out(nil)
+	exchange.Properties()[CircuitFallbackProperty] = true
+	c.fallback.Process(exchange)
+}
+
+// acquire returns the state of the circuit, the period the state belongs
+// to and whether a call is let through
+func (c *circuitBreaker) acquire() (CircuitState, uint64, bool) {
+	// the event is sent once the lock has been released
+	var event *CircuitEvent
+	defer func() { c.notify(event) }()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.state == CircuitOpen && c.now().Sub(c.openedAt) >= c.options.OpenDuration {
+		event = c.transition(CircuitHalfOpen)
+	}
+	switch c.state {
+	case CircuitOpen:
+		return c.state, c.period, false
+	case CircuitHalfOpen:
+		if c.trial >= c.options.HalfOpenCalls {
+			return c.state, c.period, false
+		}
+		c.trial++
+	}
+	return c.state, c.period, true
+}
+
+// record the outcome of a call that was let through in the period. Calls
+// that finish after the state has changed are ignored, such as a slow call
+// let through while closed that finishes while half open.
+func (c *circuitBreaker) record(period uint64, outcome circuitOutcome) {
+	// the event is sent once the lock has been released
+	var event *CircuitEvent
+	defer func() { c.notify(event) }()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if period != c.period {
+		return
+	}
+
+	switch c.state {
+	case CircuitClosed:
+		if len(c.window) < c.options.WindowSize {
+			c.window = append(c.window, outcome)
+		} else {
+			c.window[c.next] = outcome
+		}
+		c.next = (c.next + 1) % c.options.WindowSize
+		if len(c.window) >= c.options.MinimumCalls && c.exceeded(metrics(c.window)) {
+			event = c.transition(CircuitOpen)
+		}
+	case CircuitHalfOpen:
+		c.outcomes = append(c.outcomes, outcome)
+		if len(c.outcomes) < c.options.HalfOpenCalls {
+			return
+		}
+		if c.exceeded(metrics(c.outcomes)) {
+			event = c.transition(CircuitOpen)
+		} else {
+			event = c.transition(CircuitClosed)
+		}
+	}
+}
+
+func (c *circuitBreaker) exceeded(m CircuitMetrics) bool {
+	return m.FailureRate >= c.options.FailureRateThreshold || m.SlowRate >= c.options.SlowCallRateThreshold
+}
+
+// transition to the state and reset the state being kept for the new state.
+// The lock must be held.
+func (c *circuitBreaker) transition(to CircuitState) *CircuitEvent {
+	event := &CircuitEvent{
+		From: c.state,
+		To:   to,
+	}
+	if c.state == CircuitHalfOpen {
+		event.Metrics = metrics(c.outcomes)
+	} else {
+		event.Metrics = metrics(c.window)
+	}
+
+	c.state = to
+	c.period++
+	c.trial = 0
+	c.outcomes = nil
+	switch to {
+	case CircuitOpen:
+		c.openedAt = c.now()
+	case CircuitClosed:
+		c.window = c.window[:0]
+		c.next = 0
+	}
+	return event
+}
+
+func (c *circuitBreaker) notify(event *CircuitEvent) {
+	if event != nil && c.options.OnStateChange != nil {
+		c.options.OnStateChange(*event)
+	}
+}
+
+func metrics(outcomes []circuitOutcome) CircuitMetrics {
+	m := CircuitMetrics{
+		Calls: len(outcomes),
+	}
+	for _, outcome := range outcomes {
+		if outcome.failed {
+			m.FailedCalls++
+		}
+		if outcome.slow {
+			m.SlowCalls++
+		}
+	}
+	if m.Calls > 0 {
+		m.FailureRate = float64(m.FailedCalls) * 100 / float64(m.Calls)
+		m.SlowRate = float64(m.SlowCalls) * 100 / float64(m.Calls)
+	}
+	return m
+}
+
+func (c *circuitBreaker) Init() {
+	c.processors.Init()
+	c.fallback.Init()
+}
+
+func (c *circuitBreaker) Start() {
+	c.processors.Start()
+	c.fallback.Start()
+}
+
+func (c *circuitBreaker) Stop() {
+	c.processors.Stop()
+	c.fallback.Stop()
+}
+
+func (c *circuitBreaker) Close() {
+	c.processors.Close()
+	c.fallback.Close()
+}
@@ -0,0 +1,178 @@
+package core
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	context, component := newTestContext()
+
+	failing := true
+	component.handle("test:partner", func(exchange Exchange) {
+		if failing {
+			exchange.SetError(errors.New("partner failed"))
+			return
+		}
+		exchange.Out(NewTextMessage("partner reply"))
+	})
+
+	lock := sync.Mutex{}
+	events := make([]CircuitEvent, 0)
+	var breaker *circuitBreaker
+	now := time.Now()
+
+	context.Add(func(builder RouteBuilder) {
+		configuration := builder.FromS("test:start").RequestReply().
+			CircuitBreakerWith(CircuitBreakerOptions{
+				WindowSize:           4,
+				MinimumCalls:         4,
+				FailureRateThreshold: 50,
+				OpenDuration:         time.Minute,
+				HalfOpenCalls:        2,
+				OnStateChange: func(event CircuitEvent) {
+					lock.Lock()
+					defer lock.Unlock()
+					events = append(events, event)
+				},
+			})
+		breaker = configuration.(*routeConfiguration).blocks[0].(*circuitBreaker)
+		breaker.now = func() time.Time { return now }
+		configuration.
+			ToS("test:partner").
+			OnFallback().
+			ProcessFunction(func(exchange Exchange) {
+				exchange.Out(NewTextMessage("fallback"))
+			}).
+			End()
+	})
+	context.Start()
+
+	// failures are replaced by the fallback until the circuit opens
+	for idx := 0; idx < 4; idx++ {
+		exchange := component.send("test:start", NewTextMessage("hello"))
+		assert.Nil(t, exchange.Error())
+		assert.Equal(t, "fallback", exchange.In().Body())
+	}
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, CircuitOpen, events[0].To)
+	assert.Equal(t, float64(100), events[0].Metrics.FailureRate)
+
+	// the open circuit does not call the partner
+	exchange := component.send("test:start", NewTextMessage("hello"))
+	assert.Equal(t, "fallback", exchange.In().Body())
+	assert.Equal(t, CircuitOpen, exchange.Properties()[CircuitStateProperty])
+	assert.Equal(t, 4, component.count("test:partner"))
+
+	// after the open duration the trial calls close the circuit again
+	now = now.Add(2 * time.Minute)
+	failing = false
+	for idx := 0; idx < 2; idx++ {
+		exchange = component.send("test:start", NewTextMessage("hello"))
+		assert.Equal(t, "partner reply", exchange.In().Body())
+	}
+	assert.Equal(t, []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitClosed},
+		[]CircuitState{events[0].To, events[1].To, events[2].To})
+}
+
+func TestCircuitBreakerTimeout(t *testing.T) {
+	context, component := newTestContext()
+	release := make(chan struct{})
+	component.handle("test:slow", func(exchange Exchange) {
+		<-release
+	})
+
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").
+			CircuitBreakerWith(CircuitBreakerOptions{Timeout: 10 * time.Millisecond}).
+			ToS("test:slow").
+			End().
+			ToS("test:after")
+	})
+	context.Start()
+
+	exchange := component.send("test:start", NewTextMessage("hello"))
+	close(release)
+	assert.IsType(t, CircuitTimeoutError{}, exchange.Error())
+	assert.Equal(t, 0, component.count("test:after"))
+}
+
+func TestCircuitBreakerTimeoutCompletion(t *testing.T) {
+	context, component := newTestContext()
+	release := make(chan struct{})
+	component.handle("test:slow-call", func(exchange Exchange) {
+		<-release
+	})
+
+	inside := make(chan error, 2)
+	completed := make(chan error, 2)
+	context.Add(func(builder RouteBuilder) {
+		for _, name := range []string{"fast", "slow"} {
+			builder.FromS("test:" + name).
+				OnCompletion().
+				ProcessFunction(func(exchange Exchange) {
+					err, _ := exchange.Properties()[CompletionErrorProperty].(error)
+					completed <- err
+				}).
+				End().
+				CircuitBreakerWith(CircuitBreakerOptions{Timeout: 50 * time.Millisecond}).
+				ProcessFunction(func(exchange Exchange) {
+					exchange.AddOnCompletion(func(exchange Exchange, err error) {
+						inside <- err
+					})
+				}).
+				ToS("test:" + name + "-call").
+				ToS("test:" + name + "-after").
+				End()
+		}
+	})
+	context.Start()
+
+	// the callbacks of a call that finished in time stay with the exchange
+	exchange := component.send("test:fast", NewTextMessage("hello"))
+	assert.Nil(t, exchange.Error())
+	assert.Nil(t, <-inside)
+	assert.Nil(t, <-completed)
+
+	// a call that timed out fails its own callbacks, runs no more steps and
+	// holds the exchange until it has finished
+	exchange = component.send("test:slow", NewTextMessage("hello"))
+	assert.IsType(t, CircuitTimeoutError{}, exchange.Error())
+	select {
+	case <-completed:
+		t.Fatal("the exchange completed before the call that timed out finished")
+	default:
+	}
+	close(release)
+	assert.IsType(t, CircuitTimeoutError{}, <-inside)
+	assert.IsType(t, CircuitTimeoutError{}, <-completed)
+	assert.Equal(t, 1, component.count("test:slow-call"))
+	assert.Equal(t, 0, component.count("test:slow-after"))
+}
+
+func TestCircuitBreakerLateOutcome(t *testing.T) {
+	breaker := newCircuitBreaker(CircuitBreakerOptions{HalfOpenCalls: 2})
+
+	// a call let through while closed finishes after the circuit opened
+	// and went half open
+	_, closed, permitted := breaker.acquire()
+	assert.True(t, permitted)
+	breaker.lock.Lock()
+	breaker.transition(CircuitOpen)
+	breaker.transition(CircuitHalfOpen)
+	breaker.lock.Unlock()
+
+	_, halfOpen, permitted := breaker.acquire()
+	assert.True(t, permitted)
+	breaker.record(closed, circuitOutcome{failed: true})
+	breaker.record(halfOpen, circuitOutcome{})
+
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+	assert.Equal(t, []circuitOutcome{{}}, breaker.outcomes)
+	assert.Equal(t, CircuitHalfOpen, breaker.state)
+}
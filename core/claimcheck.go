@@ -0,0 +1,250 @@
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ClaimCheckOperation is what a ClaimCheck step does with the body.
+type ClaimCheckOperation int
+
+const (
+	// ClaimCheckPush stores the body and replaces it with a claim token.
+	ClaimCheckPush ClaimCheckOperation = iota
+
+	// ClaimCheckGet restores the body and leaves it in the store so that
+	// it can be restored again.
+	ClaimCheckGet
+
+	// ClaimCheckPop restores the body and removes it from the store.
+	ClaimCheckPop
+)
+
+// ClaimCheckProperty prefixes the exchange property that keeps the claim
+// token for a key along with the header of the same name.
+const ClaimCheckProperty = "ClaimCheck:"
+
+// ClaimNotFound is the error set on an exchange when there is no claim
+// token for the key or the store has nothing for the token.
+type ClaimNotFound struct {
+	Key string
+}
+
+func (c ClaimNotFound) Error() string {
+	return fmt.Sprintf("No claim was found for the key %s", c.Key)
+}
+
+// A ClaimCheckStore keeps message bodies for ClaimCheck steps by token.
+type ClaimCheckStore interface {
+	// Put the body in the store under the token.
+	Put(token string, body interface{}) error
+
+	// Get the body for the token. The body is nil if the store has
+	// nothing for the token.
+	Get(token string) (interface{}, error)
+
+	// Remove the body for the token from the store.
+	Remove(token string) error
+}
+
+// claimCheck is a step that moves the body of the in message between the
+// message and a store. The token is kept in the header named by the key so
+// that it travels with the message and in an exchange property in case a
+// later step replaces the message.
+type claimCheck struct {
+	operation ClaimCheckOperation
+	key       string
+	store     ClaimCheckStore
+}
+
+func (c *claimCheck) Process(exchange Exchange) {
+	if c.operation == ClaimCheckPush {
+		token := generator.Hex128()
+		if err := c.store.Put(token, exchange.In().Body()); err != nil {
+			exchange.SetError(err)
+			return
+		}
+		claimed := withBody(exchange.In(), token)
+		(*claimed.Headers())[c.key] = token
+		exchange.Properties()[ClaimCheckProperty+c.key] = token
+		exchange.Out(claimed)
+		return
+	}
+
+	token, found := c.token(exchange)
+	if !found {
+		exchange.SetError(ClaimNotFound{Key: c.key})
+		return
+	}
+	body, err := c.store.Get(token)
+	if err != nil {
+		exchange.SetError(err)
+		return
+	}
+	if body == nil {
+		exchange.SetError(ClaimNotFound{Key: c.key})
+		return
+	}
+	restored := withBody(exchange.In(), body)
+	if c.operation == ClaimCheckPop {
+		if err := c.store.Remove(token); err != nil {
+			exchange.SetError(err)
+			return
+		}
+		delete(*restored.Headers(), c.key)
+		delete(exchange.Properties(), ClaimCheckProperty+c.key)
+	}
+	exchange.Out(restored)
+}
+
+func (c *claimCheck) token(exchange Exchange) (string, bool) {
+	if token, ok := Header(c.key)(exchange).(string); ok {
+		return token, true
+	}
+	token, ok := exchange.Properties()[ClaimCheckProperty+c.key].(string)
+	return token, ok
+}
+
+// NewMemoryClaimCheckStore creates a ClaimCheckStore that keeps the bodies
+// in memory.
+func NewMemoryClaimCheckStore() ClaimCheckStore {
+	return &memoryClaimCheckStore{
+		bodies: make(map[string]interface{}),
+	}
+}
+
+type memoryClaimCheckStore struct {
+	lock   sync.RWMutex
+	bodies map[string]interface{}
+}
+
+func (m *memoryClaimCheckStore) Put(token string, body interface{}) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.bodies[token] = body
+	return nil
+}
+
+func (m *memoryClaimCheckStore) Get(token string) (interface{}, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.bodies[token], nil
+}
+
+func (m *memoryClaimCheckStore) Remove(token string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.bodies, token)
+	return nil
+}
+
+// UnsupportedClaimBody is the error returned by a file ClaimCheckStore for
+// a body that is not a string or a byte slice.
+type UnsupportedClaimBody struct {
+	Body interface{}
+}
+
+func (u UnsupportedClaimBody) Error() string {
+	return fmt.Sprintf("A body of type %T cannot be stored in a file", u.Body)
+}
+
+// InvalidClaimToken is the error returned by a file ClaimCheckStore for a
+// token that it could not have generated, such as one naming a file
+// outside of its directory.
+type InvalidClaimToken struct {
+	Token string
+}
+
+func (i InvalidClaimToken) Error() string {
+	return fmt.Sprintf("The claim token %q is not valid", i.Token)
+}
+
+// NewFileClaimCheckStore creates a ClaimCheckStore that keeps each body in
+// its own file in the directory, creating the directory if it is missing.
+// Only string and []byte bodies can be stored and they are restored with
+// the same type.
+func NewFileClaimCheckStore(dir string) (ClaimCheckStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &fileClaimCheckStore{
+		dir: dir,
+	}, nil
+}
+
+// the extensions record the type of the body that was stored
+const (
+	textClaimExtension   = ".txt"
+	binaryClaimExtension = ".bin"
+)
+
+type fileClaimCheckStore struct {
+	dir string
+}
+
+func (f *fileClaimCheckStore) Put(token string, body interface{}) error {
+	if err := validToken(token); err != nil {
+		return err
+	}
+	switch b := body.(type) {
+	case string:
+		return ioutil.WriteFile(f.path(token, textClaimExtension), []byte(b), 0644)
+	case []byte:
+		return ioutil.WriteFile(f.path(token, binaryClaimExtension), b, 0644)
+	}
+	return UnsupportedClaimBody{Body: body}
+}
+
+func (f *fileClaimCheckStore) Get(token string) (interface{}, error) {
+	if err := validToken(token); err != nil {
+		return nil, err
+	}
+	if text, err := ioutil.ReadFile(f.path(token, textClaimExtension)); err == nil {
+		return string(text), nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	binary, err := ioutil.ReadFile(f.path(token, binaryClaimExtension))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return binary, nil
+}
+
+func (f *fileClaimCheckStore) Remove(token string) error {
+	if err := validToken(token); err != nil {
+		return err
+	}
+	for _, extension := range []string{textClaimExtension, binaryClaimExtension} {
+		err := os.Remove(f.path(token, extension))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fileClaimCheckStore) path(token string, extension string) string {
+	return filepath.Join(f.dir, token+extension)
+}
+
+// validToken checks that the token looks like one made by the ClaimCheck
+// step, hex digits and dashes, since tokens come from message headers and
+// must not be able to name files outside of the store
+func validToken(token string) error {
+	if token == "" || filepath.Base(token) != token {
+		return InvalidClaimToken{Token: token}
+	}
+	for _, r := range token {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F' || r == '-') {
+			return InvalidClaimToken{Token: token}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClaimCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "claimcheck")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	fileStore, err := NewFileClaimCheckStore(dir)
+	assert.Nil(t, err)
+
+	for _, store := range []ClaimCheckStore{NewMemoryClaimCheckStore(), fileStore} {
+		context, component := newTestContext()
+		context.Add(func(builder RouteBuilder) {
+			builder.FromS("test:start").RequestReply().
+				ClaimCheck(ClaimCheckPush, "payload", store).
+				ToS("test:light").
+				ClaimCheck(ClaimCheckGet, "payload", store).
+				ToS("test:heavy").
+				ProcessFunction(func(exchange Exchange) {
+					// a step that does not keep the headers
+					exchange.Out(NewTextMessage("replaced"))
+				}).
+				ClaimCheck(ClaimCheckPop, "payload", store).
+				ClaimCheck(ClaimCheckGet, "payload", store)
+		})
+		context.Start()
+
+		message := NewTextMessage("a very large payload")
+		(*message.Headers())["kept"] = true
+		exchange := component.send("test:start", message)
+
+		light := component.received["test:light"][0]
+		token := (*light.Headers())["payload"]
+		assert.Equal(t, token, light.Body())
+		assert.Equal(t, true, (*light.Headers())["kept"])
+		assert.Equal(t, "a very large payload", component.received["test:heavy"][0].Body())
+
+		// the pop restored the body using the property and the get after
+		// it finds nothing
+		assert.IsType(t, ClaimNotFound{}, exchange.Error())
+		assert.Equal(t, "a very large payload", exchange.In().Body())
+		body, _ := store.Get(token.(string))
+		assert.Nil(t, body)
+	}
+}
+
+func TestFileClaimCheckStoreTypes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "claimcheck")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	store, err := NewFileClaimCheckStore(dir)
+	assert.Nil(t, err)
+
+	assert.Nil(t, store.Put("00aa", "text body"))
+	assert.Nil(t, store.Put("00bb", []byte{1, 2, 3}))
+	assert.IsType(t, UnsupportedClaimBody{}, store.Put("00cc", 12))
+
+	body, _ := store.Get("00aa")
+	assert.Equal(t, "text body", body)
+	body, _ = store.Get("00bb")
+	assert.Equal(t, []byte{1, 2, 3}, body)
+	body, _ = store.Get("00dd")
+	assert.Nil(t, body)
+}
+
+func TestFileClaimCheckStoreTraversal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "claimcheck")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	store, err := NewFileClaimCheckStore(filepath.Join(dir, "store"))
+	assert.Nil(t, err)
+	outside := filepath.Join(dir, "secret.txt")
+	assert.Nil(t, ioutil.WriteFile(outside, []byte("secret"), 0644))
+
+	for _, token := range []string{"../secret", "..", "", "a/b", "secret"} {
+		_, err := store.Get(token)
+		assert.Equal(t, InvalidClaimToken{Token: token}, err)
+		assert.Equal(t, InvalidClaimToken{Token: token}, store.Remove(token))
+		assert.Equal(t, InvalidClaimToken{Token: token}, store.Put(token, "body"))
+	}
+
+	// a pop with a token from a header cannot read or delete the file
+	context, component := newTestContext()
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:pop").ClaimCheck(ClaimCheckPop, "claim", store)
+	})
+	context.Start()
+	message := NewTextMessage("claimed")
+	(*message.Headers())["claim"] = "../secret"
+	exchange := component.send("test:pop", message)
+	assert.Equal(t, InvalidClaimToken{Token: "../secret"}, exchange.Error())
+	content, err := ioutil.ReadFile(outside)
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", string(content))
+}
@@ -0,0 +1,25 @@
+package core
+
+// CompletionErrorProperty is the exchange property that holds the error
+// the original exchange failed with when an OnCompletion sub-route is run.
+const CompletionErrorProperty = "CompletionError"
+
+// onCompletion is the sub-route opened by RouteConfiguration.OnCompletion.
+// It is run against a copy of each exchange after the exchange finishes
+// routing so that it cannot change the reply sent back to the consumer.
+type onCompletion struct {
+	mode       CompletionMode
+	processors pipeline
+}
+
+func (o *onCompletion) add(processor Processor) {
+	o.processors = append(o.processors, processor)
+}
+
+func (o *onCompletion) run(exchange Exchange, err error) {
+	completed := exchange.copy()
+	if err != nil {
+		completed.Properties()[CompletionErrorProperty] = err
+	}
+	o.processors.Process(completed)
+}
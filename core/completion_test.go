@@ -0,0 +1,74 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExchangeCompletionCallbacks(t *testing.T) {
+	context, component := newTestContext()
+
+	calls := make([]string, 0)
+	failure := errors.New("failed")
+
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").ProcessFunction(func(exchange Exchange) {
+			exchange.AddOnCompletion(func(exchange Exchange, err error) {
+				calls = append(calls, "always")
+			})
+			exchange.AddOnCompletionWhen(CompleteOnSuccess, func(exchange Exchange, err error) {
+				calls = append(calls, "success")
+			})
+			exchange.AddOnCompletionWhen(CompleteOnFailure, func(exchange Exchange, err error) {
+				assert.Equal(t, failure, err)
+				calls = append(calls, "failure")
+			})
+			if exchange.In().Body() == "fail" {
+				exchange.SetError(failure)
+			}
+		}).ToS("test:out")
+	})
+	context.Start()
+
+	exchange := component.send("test:start", NewTextMessage("ok"))
+	assert.Nil(t, exchange.Error())
+	assert.Equal(t, []string{"always", "success"}, calls)
+
+	calls = calls[:0]
+	exchange = component.send("test:start", NewTextMessage("fail"))
+	assert.Equal(t, failure, exchange.Error())
+	assert.Equal(t, []string{"always", "failure"}, calls)
+
+	// the failed exchange does not reach the producer
+	assert.Equal(t, 1, len(component.received["test:out"]))
+}
+
+func TestOnCompletionSubRoute(t *testing.T) {
+	context, component := newTestContext()
+
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").RequestReply().
+			OnCompletionWhen(CompleteOnSuccess).ToS("test:done").End().
+			OnCompletionWhen(CompleteOnFailure).ProcessFunction(func(exchange Exchange) {
+			assert.NotNil(t, exchange.Properties()[CompletionErrorProperty])
+		}).ToS("test:failed").End().
+			ProcessFunction(func(exchange Exchange) {
+				if exchange.In().Body() == "fail" {
+					exchange.SetError(errors.New("failed"))
+					return
+				}
+				exchange.Out(NewTextMessage("reply"))
+			})
+	})
+	context.Start()
+
+	exchange := component.send("test:start", NewTextMessage("ok"))
+	assert.Equal(t, "reply", exchange.In().Body())
+	component.send("test:start", NewTextMessage("fail"))
+
+	assert.Equal(t, 1, len(component.received["test:done"]))
+	assert.Equal(t, "reply", component.received["test:done"][0].Body())
+	assert.Equal(t, 1, len(component.received["test:failed"]))
+}
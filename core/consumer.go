@@ -1,7 +1,18 @@
 package core
 
+import "time"
+
 type Initiator interface {
+	// Exchange starts a new exchange on the route with the given
+	// message as the in message.
 	Exchange(in Message) Exchange
+
+	// ExchangeWithParent starts a child exchange on the route for the
+	// in message of the parent. The child keeps the breadcrumb and a
+	// copy of the properties of the parent so that one transaction can
+	// be followed across routes.
+	ExchangeWithParent(parent Exchange) Exchange
+
 	Pattern() string
 }
 
@@ -10,3 +21,35 @@ type Consumer interface {
 
 	Start(initiator Initiator)
 }
+
+// A CheckedConsumer is a Consumer that can refuse to be started, such as
+// when another route already consumes from its endpoint. Routes start a
+// CheckedConsumer with TryStart and fail to start with its error.
+type CheckedConsumer interface {
+	Consumer
+
+	// TryStart starts the consumer like Start or returns the reason that
+	// it could not be started.
+	TryStart(initiator Initiator) error
+}
+
+// A PollingConsumer is a Consumer that messages are pulled from when a
+// route asks for one instead of one that pushes messages into a route
+// through an Initiator.
+type PollingConsumer interface {
+	ConsumingService
+
+	// Receive waits up to the timeout for a message. A timeout of zero
+	// does not wait at all and a negative timeout waits until a message
+	// arrives. A nil message is returned if none arrived in time.
+	Receive(timeout time.Duration) (Message, error)
+}
+
+// A PollingEndpoint is an Endpoint that can also create a PollingConsumer.
+type PollingEndpoint interface {
+	Endpoint
+
+	// Create the PollingConsumer which will hand out messages when they
+	// are asked for.
+	CreatePollingConsumer() (PollingConsumer, error)
+}
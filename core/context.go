@@ -1,9 +1,16 @@
 package core
 
+import (
+	gocontext "context"
+	"sync"
+	"time"
+)
+
 func Create() Context {
 	return &context{
 		components: make(map[string]Component),
 		routes:     make([]Route, 0),
+		events:     &eventNotifiers{},
 	}
 }
 
@@ -18,50 +25,317 @@ type Context interface {
 	Register(creator ComponentCreator) Component
 	RegisterWithPrefix(prefix string, creator ComponentCreator) Component
 
-	Add(creator RouteCreator)
+	// Add the routes created by the creator. If a route is configured
+	// incorrectly, such as a LoadBalance block with the wrong number of
+	// weights or an endpoint that cannot create a producer, then none of
+	// the routes are added and the configuration error is returned. If a
+	// route uses the id of a route that is already in the Context, or of
+	// another route that is being added, then none of the routes are added
+	// and DuplicateRouteId is returned. If the Context is started then the
+	// routes are started and the first error of a route that could not be
+	// started, such as one consuming from an endpoint that another route
+	// already consumes from, is returned. The routes that could not be
+	// started stay in the Context as initialized so that they can be
+	// started with StartRoute or removed with RemoveRoute.
+	Add(creator RouteCreator) error
+
+	// AddEventNotifier registers the notifier to receive the events of
+	// the Context, its routes and their exchanges.
+	AddEventNotifier(notifier EventNotifier)
+
+	// Routes describes every route in the order they were added.
+	Routes() []RouteInfo
+
+	// Route describes the route with the id.
+	Route(id string) (RouteInfo, bool)
+
+	// StartRoute starts the route with the id if it is initialized or
+	// stopped, or resumes it if it is suspended.
+	StartRoute(id string) error
+
+	// StopRoute stops the route with the id if it is started or suspended.
+	// It waits for the in-flight exchanges of the route, so a step of the
+	// route stopping its own route must use StopRouteAsync instead or it
+	// waits for its own exchange until DefaultShutdownTimeout.
+	StopRoute(id string) error
+
+	// StopRouteAsync stops the route with the id like StopRoute on another
+	// goroutine and returns a channel that receives the result. A step can
+	// use it to stop its own route, which then stops once the exchange of
+	// the step and any other in-flight exchanges have completed.
+	StopRouteAsync(id string) <-chan error
+
+	// SuspendRoute stops the consumers of the started route with the id
+	// while leaving the rest of the route started.
+	SuspendRoute(id string) error
+
+	// ResumeRoute restarts the consumers of the suspended route with
+	// the id.
+	ResumeRoute(id string) error
+
+	// RemoveRoute closes the route with the id and removes it from the
+	// Context. Only routes that are initialized or stopped can be removed.
+	RemoveRoute(id string) error
+
+	// Shutdown stops the routes in the reverse order they are started. The
+	// consumers of each route are stopped first, then its in-flight
+	// exchanges are given until the Go context is done to complete before
+	// the producers of the route are stopped in reverse order. The
+	// exchanges that did not complete are reported with
+	// AbandonedExchanges. Like StopRoute it must not be called from a step
+	// of a route without another goroutine, since the exchange of the step
+	// cannot complete until the step returns.
+	Shutdown(ctx gocontext.Context) error
 }
 
 // context is the implementation of thc *context interface
 type context struct {
+	lock       sync.RWMutex
 	components map[string]Component
 	routes     []Route
+	started    bool
+	events     *eventNotifiers
+}
+
+// snapshot the routes so that they can be used without holding the lock
+func (c *context) snapshot() []Route {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return append([]Route(nil), c.routes...)
+}
+
+// component finds the component registered for the prefix
+func (c *context) component(prefix string) (Component, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	component, found := c.components[prefix]
+	return component, found
 }
 
 // Init calls each Route's Init() in turn. There is no specific
 // order to the initialization.
 func (c *context) Init() {
-	for _, route := range c.routes {
+	routes := c.snapshot()
+	for _, route := range routes {
 		route.Init()
 	}
 }
 
+// Start the routes that start automatically. Routes are started in
+// ascending StartupOrder and a route consuming from an endpoint is started
+// before the routes producing to it.
 func (c *context) Start() {
-	for _, route := range c.routes {
-		route.Start()
+	c.events.notify(ContextStartingEvent{BaseEvent{Time: time.Now()}})
+	c.setStarted(true)
+	routes := c.snapshot()
+	// todo: log routes that failed to start (waiting on choosing a log framework)
+	_ = c.start(routes)
+	c.events.notify(ContextStartedEvent{BaseEvent{Time: time.Now()}})
+}
+
+// start the routes that start automatically and return the first error of
+// a route that could not be started
+func (c *context) start(routes []Route) error {
+	var failed error
+	for _, route := range startupOrder(routes) {
+		if route.Info().AutoStartup {
+			failed = firstError(failed, route.change(RouteStarted, RouteInitialized, RouteStopped))
+		}
 	}
+	return failed
 }
 
+// Stop shuts the context down, waiting up to DefaultShutdownTimeout for
+// the in-flight exchanges of each route.
 func (c *context) Stop() {
-	for _, route := range c.routes {
-		route.Stop()
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), DefaultShutdownTimeout)
+	defer cancel()
+	// todo: log abandoned exchanges (waiting on choosing a log framework)
+	_ = c.Shutdown(ctx)
+}
+
+func (c *context) Shutdown(ctx gocontext.Context) error {
+	c.events.notify(ContextStoppingEvent{BaseEvent{Time: time.Now()}})
+	defer func() {
+		c.events.notify(ContextStoppedEvent{BaseEvent{Time: time.Now()}})
+	}()
+	c.setStarted(false)
+	routes := c.snapshot()
+	routes = startupOrder(routes)
+	var abandoned *AbandonedExchanges
+	for idx := len(routes) - 1; idx >= 0; idx-- {
+		err := routes[idx].shutdown(ctx)
+		if err, ok := err.(AbandonedExchanges); ok {
+			if abandoned == nil {
+				abandoned = &AbandonedExchanges{
+					Err:       err.Err,
+					Exchanges: make(map[string][]string),
+				}
+			}
+			for id, exchanges := range err.Exchanges {
+				abandoned.Exchanges[id] = exchanges
+			}
+		}
 	}
+	if abandoned != nil {
+		return *abandoned
+	}
+	return nil
+}
+
+func (c *context) setStarted(started bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.started = started
 }
 
 func (c *context) Close() {
-	for _, route := range c.routes {
+	routes := c.snapshot()
+	for _, route := range routes {
 		route.Close()
 	}
 }
 
-func (c *context) Add(creator RouteCreator) {
+func (c *context) Add(creator RouteCreator) error {
 	builder := &routeBuilder{
-		components:          c.components,
+		components:          c.component,
+		events:              c.events,
 		routeConfigurations: make([]*routeConfiguration, 0),
 	}
 	creator(builder)
+
+	routes := make([]Route, 0, len(builder.routeConfigurations))
 	for idx := 0; idx < len(builder.routeConfigurations); idx++ {
-		c.routes = append(c.routes, builder.routeConfigurations[idx].build())
+		route, err := builder.routeConfigurations[idx].build()
+		if err != nil {
+			return err
+		}
+		routes = append(routes, route)
+	}
+
+	started, err := c.append(routes)
+	if err != nil {
+		return err
+	}
+	if c.events.enabled() {
+		for _, route := range routes {
+			c.events.notify(RouteAddedEvent{BaseEvent: BaseEvent{Time: time.Now()}, Route: route.Info()})
+		}
+	}
+	if started {
+		for _, route := range routes {
+			route.Init()
+		}
+		return c.start(routes)
+	}
+	return nil
+}
+
+// append the routes unless one of them uses an id that is already used
+// and report whether the context is started
+func (c *context) append(routes []Route) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	ids := make(map[string]bool, len(c.routes)+len(routes))
+	for _, route := range c.routes {
+		ids[route.Id()] = true
+	}
+	for _, route := range routes {
+		if ids[route.Id()] {
+			return false, DuplicateRouteId{Id: route.Id()}
+		}
+		ids[route.Id()] = true
+	}
+	c.routes = append(c.routes, routes...)
+	return c.started, nil
+}
+
+func (c *context) AddEventNotifier(notifier EventNotifier) {
+	c.events.add(notifier)
+}
+
+func (c *context) Routes() []RouteInfo {
+	routes := c.snapshot()
+	infos := make([]RouteInfo, 0, len(routes))
+	for _, route := range routes {
+		infos = append(infos, route.Info())
+	}
+	return infos
+}
+
+func (c *context) Route(id string) (RouteInfo, bool) {
+	route, found := c.route(id)
+	if !found {
+		return RouteInfo{}, false
+	}
+	return route.Info(), true
+}
+
+func (c *context) route(id string) (Route, bool) {
+	routes := c.snapshot()
+	for _, route := range routes {
+		if route.Id() == id {
+			return route, true
+		}
+	}
+	return nil, false
+}
+
+func (c *context) StartRoute(id string) error {
+	return c.change(id, RouteStarted, RouteInitialized, RouteStopped, RouteSuspended)
+}
+
+func (c *context) StopRoute(id string) error {
+	return c.change(id, RouteStopped, RouteStarted, RouteSuspended)
+}
+
+func (c *context) StopRouteAsync(id string) <-chan error {
+	result := make(chan error, 1)
+	route, found := c.route(id)
+	if !found {
+		result <- UnknownRoute{Id: id}
+		return result
+	}
+	go func() {
+		result <- route.change(RouteStopped, RouteStarted, RouteSuspended)
+	}()
+	return result
+}
+
+func (c *context) SuspendRoute(id string) error {
+	return c.change(id, RouteSuspended, RouteStarted)
+}
+
+func (c *context) ResumeRoute(id string) error {
+	return c.change(id, RouteStarted, RouteSuspended)
+}
+
+func (c *context) change(id string, to RouteStatus, from ...RouteStatus) error {
+	route, found := c.route(id)
+	if !found {
+		return UnknownRoute{Id: id}
+	}
+	return route.change(to, from...)
+}
+
+func (c *context) RemoveRoute(id string) error {
+	route, found := c.route(id)
+	if !found {
+		return UnknownRoute{Id: id}
+	}
+	if err := route.remove(); err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for idx, existing := range c.routes {
+		if existing == route {
+			c.routes = append(c.routes[:idx:idx], c.routes[idx+1:]...)
+			break
+		}
 	}
+	return nil
 }
 
 func (c *context) Register(creator ComponentCreator) Component {
@@ -77,6 +351,8 @@ func (c *context) RegisterWithPrefix(prefix string, creator ComponentCreator) Co
 }
 
 func (c *context) register(prefix string, component Component) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
 	if _, found := c.components[prefix]; found {
 		// todo: log out component overwrite
 		return
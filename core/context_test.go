@@ -1,8 +1,13 @@
 package core
 
 import (
+	gocontext "context"
+	"errors"
 	"fmt"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 // testApiUsability a standalone test to establish that the APi is at
@@ -24,3 +29,178 @@ func TestApiUsability(t *testing.T) {
 		builder.FromF("direct:route%d", 3).ToF("direct:%s", "12")
 	})
 }
+
+func TestRouteLifecycle(t *testing.T) {
+	context, component := newTestContext()
+	assert.Nil(t, context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:in").RouteID("route").ToS("test:out")
+	}))
+
+	assert.Equal(t, InvalidRouteTransition{Id: "route", From: RouteInitialized, To: RouteSuspended}, context.SuspendRoute("route"))
+	assert.Nil(t, context.StartRoute("route"))
+	assert.Equal(t, "started", component.state("test:out"))
+	assert.NotNil(t, component.send("test:in", NewTextMessage("one")))
+	assert.Equal(t, InvalidRouteTransition{Id: "route", From: RouteStarted, To: RouteStarted}, context.ResumeRoute("route"))
+
+	assert.Nil(t, context.SuspendRoute("route"))
+	assert.Equal(t, RouteSuspended, routeStatus(context, "route"))
+	assert.Nil(t, component.send("test:in", NewTextMessage("two")))
+	assert.Equal(t, "started", component.state("test:out"))
+	assert.Equal(t, InvalidRouteTransition{Id: "route", From: RouteSuspended, To: RouteRemoved}, context.RemoveRoute("route"))
+
+	assert.Nil(t, context.ResumeRoute("route"))
+	assert.NotNil(t, component.send("test:in", NewTextMessage("three")))
+	assert.Equal(t, 2, component.count("test:out"))
+
+	assert.Nil(t, context.StopRoute("route"))
+	assert.Equal(t, "stopped", component.state("test:out"))
+	assert.Nil(t, component.send("test:in", NewTextMessage("four")))
+	assert.Equal(t, InvalidRouteTransition{Id: "route", From: RouteStopped, To: RouteStopped}, context.StopRoute("route"))
+
+	assert.Nil(t, context.RemoveRoute("route"))
+	assert.Equal(t, "closed", component.state("test:out"))
+	assert.Equal(t, 0, len(context.Routes()))
+	assert.Equal(t, UnknownRoute{Id: "route"}, context.StartRoute("route"))
+}
+
+func TestAddToStartedContext(t *testing.T) {
+	context, component := newTestContext()
+	context.Start()
+	assert.Nil(t, context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:in").RouteID("late").ToS("test:out")
+	}))
+
+	assert.Equal(t, RouteStarted, routeStatus(context, "late"))
+	assert.NotNil(t, component.send("test:in", NewTextMessage("hello")))
+	assert.Equal(t, 1, component.count("test:out"))
+
+	context.Stop()
+	assert.Equal(t, RouteStopped, routeStatus(context, "late"))
+	assert.Nil(t, context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:other").RouteID("stopped").ToS("test:out")
+	}))
+	assert.Equal(t, RouteInitialized, routeStatus(context, "stopped"))
+}
+
+func TestAddRouteThatFailsToStart(t *testing.T) {
+	context, component := newTestContext()
+	context.Start()
+	defer context.Stop()
+	refused := errors.New("refused")
+	component.refuse("test:busy", refused)
+	assert.Equal(t, refused, context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:free").RouteID("free").ToS("test:out")
+		builder.FromS("test:busy").RouteID("busy").ToS("test:out")
+	}))
+
+	// the routes stay in the context and the failed one can be started
+	// once the cause has gone
+	assert.Equal(t, RouteStarted, routeStatus(context, "free"))
+	assert.Equal(t, RouteInitialized, routeStatus(context, "busy"))
+	assert.Nil(t, component.send("test:busy", NewTextMessage("refused")))
+	component.refuse("test:busy", nil)
+	assert.Nil(t, context.StartRoute("busy"))
+	assert.NotNil(t, component.send("test:busy", NewTextMessage("accepted")))
+	assert.Equal(t, 1, component.count("test:out"))
+}
+
+func routeStatus(context Context, id string) RouteStatus {
+	info, _ := context.Route(id)
+	return info.Status
+}
+
+func TestShutdownDrainsInflight(t *testing.T) {
+	context, component := newTestContext()
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	component.handle("test:slow", func(exchange Exchange) {
+		close(entered)
+		<-release
+	})
+	assert.Nil(t, context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:in").RouteID("route").ToS("test:slow").ToS("test:out")
+	}))
+	context.Start()
+
+	sent := make(chan Exchange)
+	go func() {
+		sent <- component.send("test:in", NewTextMessage("hello"))
+	}()
+	<-entered
+
+	shutdown := make(chan error)
+	go func() {
+		shutdown <- context.Shutdown(gocontext.Background())
+	}()
+	assert.Eventually(t, func() bool {
+		return component.send("test:in", NewTextMessage("late")) == nil
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, "started", component.state("test:out"))
+
+	close(release)
+	assert.Nil(t, (<-sent).Error())
+	assert.Nil(t, <-shutdown)
+	assert.Equal(t, 1, component.count("test:out"))
+	assert.Equal(t, "stopped", component.state("test:out"))
+	assert.Equal(t, RouteStopped, routeStatus(context, "route"))
+}
+
+func TestShutdownAbandons(t *testing.T) {
+	context, component := newTestContext()
+	ids := make(chan string, 1)
+	release := make(chan struct{})
+	defer close(release)
+	component.handle("test:slow", func(exchange Exchange) {
+		ids <- exchange.Id()
+		<-release
+	})
+	assert.Nil(t, context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:in").RouteID("route").ToS("test:slow")
+		builder.FromS("test:idle").RouteID("idle").ToS("test:out")
+	}))
+	context.Start()
+
+	go component.send("test:in", NewTextMessage("hello"))
+	id := <-ids
+
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := context.Shutdown(ctx)
+	assert.True(t, errors.Is(err, gocontext.DeadlineExceeded))
+	assert.Equal(t, map[string][]string{"route": {id}}, err.(AbandonedExchanges).Exchanges)
+	assert.Equal(t, "stopped", component.state("test:slow"))
+	assert.Equal(t, RouteStopped, routeStatus(context, "route"))
+	assert.Equal(t, RouteStopped, routeStatus(context, "idle"))
+}
+
+func TestRouteStopsItself(t *testing.T) {
+	context, component := newTestContext()
+	stopped := make(chan (<-chan error), 1)
+	assert.Nil(t, context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:in").RouteID("self").
+			ProcessFunction(func(exchange Exchange) {
+				stopped <- context.StopRouteAsync("self")
+			}).
+			ToS("test:out")
+	}))
+	context.Start()
+	defer context.Stop()
+
+	start := time.Now()
+	exchange := component.send("test:in", NewTextMessage("hello"))
+	assert.Nil(t, exchange.Error())
+	assert.Equal(t, 1, component.count("test:out"))
+
+	// the route stops as soon as the exchange that stopped it completes
+	select {
+	case err := <-<-stopped:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the route waited for the exchange that stopped it")
+	}
+	assert.True(t, time.Since(start) < DefaultShutdownTimeout)
+	assert.Equal(t, RouteStopped, routeStatus(context, "self"))
+	assert.Equal(t, "stopped", component.state("test:out"))
+
+	assert.IsType(t, UnknownRoute{}, <-context.StopRouteAsync("missing"))
+}
@@ -0,0 +1,243 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DelayStopPolicy decides what happens to exchanges that are still being
+// delayed when a Delay block is stopped.
+type DelayStopPolicy int
+
+const (
+	// FlushOnStop ends the delay early and runs the steps of the block.
+	FlushOnStop DelayStopPolicy = iota
+
+	// RejectOnStop fails the exchanges with a DelayRejected error.
+	RejectOnStop
+)
+
+// DelayOptions configure a Delay block.
+type DelayOptions struct {
+	// Async hands the exchange to a scheduler instead of blocking the
+	// goroutine that is processing it. The steps of the block run later
+	// on another goroutine against a copy of the exchange and its message
+	// while the steps after the End of the block run straight away. The
+	// exchange does not complete until the delayed steps have run, so its
+	// completion callbacks, such as those of OnCompletion, Transacted and
+	// Idempotent, see an error from the delayed steps as a failure of the
+	// exchange.
+	Async bool
+
+	// OnStop is what happens to exchanges still being delayed when the
+	// block is stopped.
+	OnStop DelayStopPolicy
+}
+
+// DelayRejected is the error set on an exchange that was still being
+// delayed when the route was stopped with the RejectOnStop policy.
+type DelayRejected struct {
+}
+
+func (d DelayRejected) Error() string {
+	return fmt.Sprint("The delayed exchange was rejected because the route stopped")
+}
+
+// InvalidDelay is the error set on an exchange when the delay expression
+// does not evaluate to a delay.
+type InvalidDelay struct {
+	Value interface{}
+}
+
+func (i InvalidDelay) Error() string {
+	return fmt.Sprintf("The value %v is not a delay", i.Value)
+}
+
+// delayUntil converts the value of a delay expression into the time the
+// delay ends. A time.Time is used as is, a time.Duration or a string that
+// time.ParseDuration accepts is added to now, an integer is a number of
+// milliseconds added to now, and another string is parsed as an RFC 3339
+// timestamp.
+func delayUntil(value interface{}, now time.Time) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case time.Duration:
+		return now.Add(v), nil
+	case int:
+		return now.Add(time.Duration(v) * time.Millisecond), nil
+	case int64:
+		return now.Add(time.Duration(v) * time.Millisecond), nil
+	case string:
+		if duration, err := time.ParseDuration(v); err == nil {
+			return now.Add(duration), nil
+		}
+		if millis, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return now.Add(time.Duration(millis) * time.Millisecond), nil
+		}
+		if timestamp, err := time.Parse(time.RFC3339, v); err == nil {
+			return timestamp, nil
+		}
+	}
+	return time.Time{}, InvalidDelay{Value: value}
+}
+
+// a delayed exchange waiting in the scheduler
+type delayed struct {
+	exchange Exchange
+	release  func(result Exchange)
+	timer    *time.Timer
+}
+
+// delayer is the block opened by RouteConfiguration.Delay. It holds each
+// exchange until the time computed by the expression and then runs the
+// steps of the block.
+type delayer struct {
+	expression Expression
+	options    DelayOptions
+	processors pipeline
+
+	lock      sync.Mutex
+	running   bool
+	stop      chan struct{}
+	scheduled map[*delayed]struct{}
+	pending   sync.WaitGroup
+}
+
+func newDelayer(expression Expression, options DelayOptions) *delayer {
+	return &delayer{
+		expression: expression,
+		options:    options,
+		processors: make(pipeline, 0),
+		scheduled:  make(map[*delayed]struct{}),
+	}
+}
+
+func (d *delayer) add(processor Processor) {
+	d.processors = append(d.processors, processor)
+}
+
+func (d *delayer) Process(exchange Exchange) {
+	until, err := delayUntil(d.expression(exchange), time.Now())
+	if err != nil {
+		exchange.SetError(err)
+		return
+	}
+	wait := time.Until(until)
+
+	d.lock.Lock()
+	running, stop := d.running, d.stop
+	if !running || !d.options.Async {
+		d.lock.Unlock()
+		d.block(exchange, wait, running, stop)
+		return
+	}
+	// the delayed steps get their own copy of the message since the route
+	// carries on changing the original at the same time
+	copied := exchange.copy()
+	copied.Out(CopyMessage(exchange.In()))
+	copied.rotate()
+	entry := &delayed{
+		exchange: copied,
+		release:  exchange.hold(),
+	}
+	d.scheduled[entry] = struct{}{}
+	d.pending.Add(1)
+	entry.timer = time.AfterFunc(wait, func() {
+		d.fire(entry, false)
+	})
+	d.lock.Unlock()
+}
+
+// block the calling goroutine for the delay unless the block is stopped
+func (d *delayer) block(exchange Exchange, wait time.Duration, running bool, stop chan struct{}) {
+	if !running {
+		d.release(exchange, d.options.OnStop == RejectOnStop)
+		return
+	}
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-stop:
+			d.release(exchange, d.options.OnStop == RejectOnStop)
+			return
+		}
+	}
+	d.processors.Process(exchange)
+}
+
+// release an exchange early either by running the steps or rejecting it
+func (d *delayer) release(exchange Exchange, reject bool) {
+	if reject {
+		exchange.SetError(DelayRejected{})
+		return
+	}
+	d.processors.Process(exchange)
+}
+
+// fire runs the steps for a scheduled exchange once and releases the
+// exchange it was copied from
+func (d *delayer) fire(entry *delayed, reject bool) {
+	d.lock.Lock()
+	if _, found := d.scheduled[entry]; !found {
+		d.lock.Unlock()
+		return
+	}
+	delete(d.scheduled, entry)
+	d.lock.Unlock()
+	defer d.pending.Done()
+
+	if reject {
+		entry.exchange.SetError(DelayRejected{})
+	} else {
+		d.processors.Process(entry.exchange)
+	}
+	entry.exchange.rotate()
+	entry.release(entry.exchange)
+}
+
+func (d *delayer) Init() {
+	d.processors.Init()
+}
+
+func (d *delayer) Start() {
+	d.processors.Start()
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if !d.running {
+		d.running = true
+		d.stop = make(chan struct{})
+	}
+}
+
+// Stop releases every exchange that is still being delayed according to
+// the stop policy and waits for them before stopping the steps.
+func (d *delayer) Stop() {
+	d.lock.Lock()
+	scheduled := make([]*delayed, 0, len(d.scheduled))
+	if d.running {
+		d.running = false
+		close(d.stop)
+		for entry := range d.scheduled {
+			scheduled = append(scheduled, entry)
+		}
+	}
+	d.lock.Unlock()
+
+	for _, entry := range scheduled {
+		if entry.timer.Stop() {
+			d.fire(entry, d.options.OnStop == RejectOnStop)
+		}
+	}
+	d.pending.Wait()
+	d.processors.Stop()
+}
+
+func (d *delayer) Close() {
+	d.processors.Close()
+}
@@ -0,0 +1,168 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDelayUntil(t *testing.T) {
+	now := time.Now()
+	for _, value := range []interface{}{50 * time.Millisecond, 50, int64(50), "50ms", "50", now.Add(50 * time.Millisecond)} {
+		until, err := delayUntil(value, now)
+		assert.Nil(t, err)
+		assert.Equal(t, 50*time.Millisecond, until.Sub(now))
+	}
+	_, err := delayUntil("soon", now)
+	assert.IsType(t, InvalidDelay{}, err)
+}
+
+func TestDelay(t *testing.T) {
+	context, component := newTestContext()
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").Delay(Header("delay")).ToS("test:out").End()
+	})
+	context.Start()
+	defer context.Stop()
+
+	message := NewTextMessage("hello")
+	(*message.Headers())["delay"] = 20 * time.Millisecond
+	start := time.Now()
+	component.send("test:start", message)
+	assert.True(t, time.Since(start) >= 20*time.Millisecond)
+	assert.Equal(t, 1, component.count("test:out"))
+}
+
+func TestAsyncDelay(t *testing.T) {
+	context, component := newTestContext()
+	completed := make(chan error, 1)
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").
+			ProcessFunction(func(exchange Exchange) {
+				exchange.AddOnCompletion(func(exchange Exchange, err error) {
+					completed <- err
+				})
+			}).
+			DelayWith(Constant(20*time.Millisecond), DelayOptions{Async: true}).
+			ToS("test:delayed").
+			End().
+			ToS("test:immediate")
+	})
+	context.Start()
+	defer context.Stop()
+
+	component.send("test:start", NewTextMessage("hello"))
+	assert.Equal(t, 1, component.count("test:immediate"))
+	assert.Equal(t, 0, component.count("test:delayed"))
+
+	// the exchange completes once the delayed steps have run
+	assert.Nil(t, <-completed)
+	assert.Equal(t, 1, component.count("test:delayed"))
+}
+
+func TestDelayStopPolicies(t *testing.T) {
+	for _, policy := range []DelayStopPolicy{FlushOnStop, RejectOnStop} {
+		context, component := newTestContext()
+		completed := make(chan error, 1)
+		context.Add(func(builder RouteBuilder) {
+			builder.FromS("test:start").
+				ProcessFunction(func(exchange Exchange) {
+					exchange.AddOnCompletion(func(exchange Exchange, err error) {
+						completed <- err
+					})
+				}).
+				DelayWith(Constant(time.Hour), DelayOptions{Async: true, OnStop: policy}).
+				ToS("test:delayed").
+				End()
+		})
+		context.Start()
+
+		component.send("test:start", NewTextMessage("hello"))
+		context.Stop()
+
+		err := <-completed
+		if policy == FlushOnStop {
+			assert.Nil(t, err)
+			assert.Equal(t, 1, component.count("test:delayed"))
+		} else {
+			assert.IsType(t, DelayRejected{}, err)
+			assert.Equal(t, 0, component.count("test:delayed"))
+		}
+	}
+}
+
+func TestAsyncDelayCompletion(t *testing.T) {
+	context, component := newTestContext()
+	completed := make(chan error, 1)
+	failed := make(chan ExchangeFailedEvent, 1)
+	context.AddEventNotifier(EventNotifierFunction(func(event Event) {
+		if event, ok := event.(ExchangeFailedEvent); ok {
+			failed <- event
+		}
+	}))
+	component.handle("test:delayed", func(exchange Exchange) {
+		exchange.SetError(errors.New("failed after the delay"))
+	})
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").
+			OnCompletion().
+			ProcessFunction(func(exchange Exchange) {
+				err, _ := exchange.Properties()[CompletionErrorProperty].(error)
+				completed <- err
+			}).
+			End().
+			DelayWith(Constant(20*time.Millisecond), DelayOptions{Async: true}).
+			ToS("test:delayed").
+			End().
+			ToS("test:immediate")
+	})
+	context.Start()
+	defer context.Stop()
+
+	exchange := component.send("test:start", NewTextMessage("hello"))
+	assert.Equal(t, 1, component.count("test:immediate"))
+	select {
+	case <-completed:
+		t.Fatal("the exchange completed before the delayed steps ran")
+	case <-failed:
+		t.Fatal("the exchange was reported before the delayed steps ran")
+	default:
+	}
+
+	assert.EqualError(t, <-completed, "failed after the delay")
+	event := <-failed
+	assert.Equal(t, exchange.Id(), event.Exchange.Id())
+	assert.EqualError(t, event.Err, "failed after the delay")
+	assert.EqualError(t, exchange.Error(), "failed after the delay")
+}
+
+func TestAsyncDelayCopiesMessage(t *testing.T) {
+	context, component := newTestContext()
+	seen := make(chan interface{}, 1)
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").
+			DelayWith(Constant(time.Millisecond), DelayOptions{Async: true}).
+			ProcessFunction(func(exchange Exchange) {
+				seen <- (*exchange.In().Headers())["step"]
+			}).
+			End().
+			ProcessFunction(func(exchange Exchange) {
+				// the route changes the headers while the delayed steps
+				// read them, which the race detector catches if the
+				// message is shared
+				for idx := 0; idx < 100; idx++ {
+					(*exchange.In().Headers())["step"] = idx
+				}
+			})
+	})
+	context.Start()
+	defer context.Stop()
+
+	message := NewTextMessage("hello")
+	(*message.Headers())["step"] = "before"
+	exchange := component.send("test:start", message)
+	assert.Equal(t, "before", <-seen)
+	assert.Equal(t, 99, (*exchange.In().Headers())["step"])
+}
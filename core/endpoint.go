@@ -2,6 +2,7 @@ package core
 
 import (
 	"fmt"
+	"net/url"
 	"strings"
 )
 
@@ -39,6 +40,26 @@ func (n NotAProducerEndpoint) Error() string {
 	return fmt.Sprint("This Endpoint cannot create Producers")
 }
 
+// NotAPollingEndpoint is an error that should be returned when the
+// Endpoint cannot create a PollingConsumer.
+type NotAPollingEndpoint struct {
+}
+
+func (n NotAPollingEndpoint) Error() string {
+	return fmt.Sprint("This Endpoint cannot create Polling Consumers")
+}
+
+// UnknownEndpoint is an error that is returned when an endpoint string
+// does not have a prefix matching a Component registered with the
+// Context.
+type UnknownEndpoint struct {
+	Endpoint string
+}
+
+func (u UnknownEndpoint) Error() string {
+	return fmt.Sprintf("No Component is registered for the Endpoint %s", u.Endpoint)
+}
+
 // Parse returns the parsed information consumers an endpiont string. This allows
 // implementors of endpoints to test the parsing behavior that will be
 // followed by the FromS/FromF and ToS/ToF methods of the RouteBuilder and
@@ -53,6 +74,28 @@ func Parse(endpoint string) (string, string, string, map[string]string) {
 	if optx < 0 || optx < idx {
 		return endpoint[0:idx], endpoint[idx+1:], "", options
 	}
-	// todo: parse the options string
-	return endpoint[0:idx], endpoint[idx+1 : optx], endpoint[optx+1:], options
+	optStr := endpoint[optx+1:]
+	if values, err := url.ParseQuery(optStr); err == nil {
+		for key := range values {
+			options[key] = values.Get(key)
+		}
+	}
+	return endpoint[0:idx], endpoint[idx+1 : optx], optStr, options
+}
+
+// componentLookup finds the Component registered for a prefix. Lookups read
+// through to the Context so that components registered after a route was
+// added can still be resolved while the route runs.
+type componentLookup func(prefix string) (Component, bool)
+
+// resolveEndpoint creates the Endpoint for an endpoint string using the
+// Component registered for its prefix. The Component is given the endpoint
+// string without the options and the parsed options separately.
+func resolveEndpoint(components componentLookup, endpoint string) (Endpoint, error) {
+	prefix, path, _, options := Parse(endpoint)
+	component, found := components(prefix)
+	if !found || prefix == "" {
+		return nil, UnknownEndpoint{Endpoint: endpoint}
+	}
+	return component.CreateEndpoint(prefix+":"+path, options), nil
 }
@@ -42,3 +42,10 @@ func TestParse(t *testing.T) {
 	assert.Equal(t, "/some/path/url", url)
 	assert.Equal(t, "option1=option&option2=option", optStr)
 }
+
+func TestParseOptions(t *testing.T) {
+	_, _, _, options := Parse("prefix:/some/path/url?option1=option&option2=two%20words")
+	assert.Equal(t, 2, len(options))
+	assert.Equal(t, "option", options["option1"])
+	assert.Equal(t, "two words", options["option2"])
+}
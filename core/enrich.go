@@ -0,0 +1,99 @@
+package core
+
+import "time"
+
+// enrich sends a copy of the exchange to a producer as a request/reply
+// exchange and merges the reply into the exchange with the strategy. The
+// strategy is given the exchange as the old exchange and the reply as the
+// new exchange.
+type enrich struct {
+	producer Producer
+	strategy AggregationStrategy
+}
+
+func (e *enrich) Process(exchange Exchange) {
+	resource := newChildExchange(exchange, RequestReplyExchange)
+	resource.Out(CopyMessage(exchange.In()))
+	resource.rotate()
+	e.producer.Process(resource)
+	resource.rotate()
+	if resource.Error() != nil {
+		exchange.SetError(resource.Error())
+		return
+	}
+	merge(exchange, resource, e.strategy)
+}
+
+func (e *enrich) Init() {
+	e.producer.Init()
+}
+
+func (e *enrich) Start() {
+	e.producer.Start()
+}
+
+func (e *enrich) Stop() {
+	e.producer.Stop()
+}
+
+func (e *enrich) Close() {
+	e.producer.Close()
+}
+
+// pollEnrich receives a single message from a polling consumer and merges
+// it into the exchange with the strategy. When no message arrives before
+// the timeout the exchange is left as it was.
+type pollEnrich struct {
+	consumer PollingConsumer
+	timeout  time.Duration
+	strategy AggregationStrategy
+}
+
+func (p *pollEnrich) Process(exchange Exchange) {
+	message, err := p.consumer.Receive(p.timeout)
+	if err != nil {
+		exchange.SetError(err)
+		return
+	}
+	if message == nil {
+		return
+	}
+	resource := newChildExchange(exchange, exchange.Pattern())
+	resource.Out(message)
+	resource.rotate()
+	merge(exchange, resource, p.strategy)
+}
+
+func (p *pollEnrich) Init() {
+	p.consumer.Init()
+}
+
+func (p *pollEnrich) Start() {
+	p.consumer.Start()
+}
+
+func (p *pollEnrich) Stop() {
+	p.consumer.Stop()
+}
+
+func (p *pollEnrich) Close() {
+	p.consumer.Close()
+}
+
+// merge the resource into the exchange with the strategy. A strategy can
+// either change the exchange it was given and return it or return another
+// exchange whose in message becomes the out message of the exchange.
+func merge(exchange Exchange, resource Exchange, strategy AggregationStrategy) {
+	if strategy == nil {
+		strategy = UseLatest
+	}
+	result := strategy.Aggregate(exchange, resource)
+	if result == nil || result == exchange {
+		return
+	}
+	if result.Error() != nil {
+		exchange.SetError(result.Error())
+		return
+	}
+	exchange.Out(result.In())
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnrich(t *testing.T) {
+	context, component := newTestContext()
+	component.handle("test:customer", func(exchange Exchange) {
+		assert.Equal(t, RequestReplyExchange, exchange.Pattern())
+		exchange.Out(NewTextMessage("customer for " + exchange.In().Body().(string)))
+	})
+	component.handle("test:broken", func(exchange Exchange) {
+		exchange.SetError(errors.New("broken"))
+	})
+
+	headerStrategy := AggregationFunction(func(original Exchange, resource Exchange) Exchange {
+		(*original.In().Headers())["customer"] = resource.In().Body()
+		return original
+	})
+
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:replace").Enrich("test:customer", nil).ToS("test:out")
+		builder.FromS("test:merge").Enrich("test:customer", headerStrategy).ToS("test:out")
+		builder.FromS("test:broken").Enrich("test:broken", nil).ToS("test:out")
+	})
+	context.Start()
+
+	component.send("test:replace", NewTextMessage("order"))
+	assert.Equal(t, "customer for order", component.received["test:out"][0].Body())
+
+	component.send("test:merge", NewTextMessage("order"))
+	merged := component.received["test:out"][1]
+	assert.Equal(t, "order", merged.Body())
+	assert.Equal(t, "customer for order", (*merged.Headers())["customer"])
+
+	exchange := component.send("test:broken", NewTextMessage("order"))
+	assert.NotNil(t, exchange.Error())
+	assert.Equal(t, 2, component.count("test:out"))
+}
+
+func TestPollEnrichNotPolling(t *testing.T) {
+	context, _ := newTestContext()
+	err := context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").PollEnrich("test:push", time.Millisecond, nil)
+	})
+	assert.Equal(t, NotAPollingEndpoint{}, err)
+	assert.Empty(t, context.Routes())
+}
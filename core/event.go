@@ -0,0 +1,197 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// An Event is something that happened in a Context and is reported to
+// the EventNotifiers registered with Context.AddEventNotifier. Use a type
+// switch to tell the events apart.
+type Event interface {
+	Timestamp() time.Time
+}
+
+// BaseEvent holds the time that is common to every Event.
+type BaseEvent struct {
+	Time time.Time
+}
+
+func (b BaseEvent) Timestamp() time.Time {
+	return b.Time
+}
+
+// An EventNotifier receives the events of a Context. Notify is called on
+// the goroutine where the event happened, so it can be called from many
+// goroutines at the same time and should return quickly.
+type EventNotifier interface {
+	Notify(event Event)
+}
+
+// EventNotifierFunction adapts a function to an EventNotifier.
+type EventNotifierFunction func(event Event)
+
+func (e EventNotifierFunction) Notify(event Event) {
+	e(event)
+}
+
+// ContextStartingEvent is sent before the routes of a Context are started.
+type ContextStartingEvent struct {
+	BaseEvent
+}
+
+// ContextStartedEvent is sent after the routes of a Context are started.
+type ContextStartedEvent struct {
+	BaseEvent
+}
+
+// ContextStoppingEvent is sent before the routes of a Context are stopped.
+type ContextStoppingEvent struct {
+	BaseEvent
+}
+
+// ContextStoppedEvent is sent after the routes of a Context are stopped.
+type ContextStoppedEvent struct {
+	BaseEvent
+}
+
+// RouteAddedEvent is sent when a route is added to a Context.
+type RouteAddedEvent struct {
+	BaseEvent
+	Route RouteInfo
+}
+
+// RouteStartedEvent is sent when a route is started or resumed.
+type RouteStartedEvent struct {
+	BaseEvent
+	Route RouteInfo
+}
+
+// RouteStoppedEvent is sent when a route is stopped.
+type RouteStoppedEvent struct {
+	BaseEvent
+	Route RouteInfo
+}
+
+// ExchangeCreatedEvent is sent when a route creates an exchange for a
+// message from one of its consumers or from a calling route.
+type ExchangeCreatedEvent struct {
+	BaseEvent
+	RouteId  string
+	Exchange Exchange
+}
+
+// ExchangeCompletedEvent is sent when a route finishes an exchange
+// without an error.
+type ExchangeCompletedEvent struct {
+	BaseEvent
+	RouteId  string
+	Exchange Exchange
+}
+
+// ExchangeFailedEvent is sent when a route finishes an exchange with an
+// error.
+type ExchangeFailedEvent struct {
+	BaseEvent
+	RouteId  string
+	Exchange Exchange
+	Err      error
+}
+
+// ExchangeSentEvent is sent after an exchange has been sent to an endpoint,
+// whether or not the endpoint failed the exchange.
+type ExchangeSentEvent struct {
+	BaseEvent
+	RouteId  string
+	Exchange Exchange
+	Endpoint string
+	Duration time.Duration
+}
+
+// ExchangeRedeliveryEvent is sent when an exchange that failed is tried
+// again, such as on the next step of a failover LoadBalance. Attempt counts
+// the redeliveries of the exchange starting at 1 and Err is the error of
+// the previous attempt.
+type ExchangeRedeliveryEvent struct {
+	BaseEvent
+	RouteId  string
+	Exchange Exchange
+	Attempt  int
+	Err      error
+}
+
+// eventNotifiers are the EventNotifiers registered with a Context. A nil
+// *eventNotifiers has no notifiers.
+type eventNotifiers struct {
+	lock      sync.RWMutex
+	notifiers []EventNotifier
+}
+
+func (e *eventNotifiers) add(notifier EventNotifier) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.notifiers = append(e.notifiers, notifier)
+}
+
+// enabled returns true if there are notifiers, so that events that are
+// expensive to create can be skipped
+func (e *eventNotifiers) enabled() bool {
+	if e == nil {
+		return false
+	}
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return len(e.notifiers) > 0
+}
+
+func (e *eventNotifiers) notify(event Event) {
+	if e == nil {
+		return
+	}
+	e.lock.RLock()
+	notifiers := e.notifiers
+	e.lock.RUnlock()
+	for _, notifier := range notifiers {
+		notifier.Notify(event)
+	}
+}
+
+// sendingProducer is a Producer that reports each exchange it sends to its
+// endpoint with an ExchangeSentEvent.
+type sendingProducer struct {
+	Producer
+	routeId  *string
+	endpoint string
+	events   *eventNotifiers
+}
+
+// newSendingProducer wraps the producer for the endpoint. The id of the
+// route is read when exchanges are sent because it is only final once the
+// route is built.
+func newSendingProducer(producer Producer, endpoint string, routeId *string, events *eventNotifiers) Producer {
+	if events == nil {
+		return producer
+	}
+	return &sendingProducer{
+		Producer: producer,
+		routeId:  routeId,
+		endpoint: endpoint,
+		events:   events,
+	}
+}
+
+func (s *sendingProducer) Process(exchange Exchange) {
+	if !s.events.enabled() {
+		s.Producer.Process(exchange)
+		return
+	}
+	start := time.Now()
+	s.Producer.Process(exchange)
+	s.events.notify(ExchangeSentEvent{
+		BaseEvent: BaseEvent{Time: time.Now()},
+		RouteId:   *s.routeId,
+		Exchange:  exchange,
+		Endpoint:  s.endpoint,
+		Duration:  time.Since(start),
+	})
+}
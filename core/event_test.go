@@ -0,0 +1,110 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type eventRecorder struct {
+	lock   sync.Mutex
+	events []Event
+}
+
+func (e *eventRecorder) Notify(event Event) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.events = append(e.events, event)
+}
+
+func (e *eventRecorder) types() []string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	types := make([]string, 0, len(e.events))
+	for _, event := range e.events {
+		types = append(types, fmt.Sprintf("%T", event))
+	}
+	return types
+}
+
+func TestEventNotifier(t *testing.T) {
+	context, component := newTestContext()
+	recorder := &eventRecorder{}
+	context.AddEventNotifier(recorder)
+	assert.Nil(t, context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:in").RouteID("route").ToS("test:out")
+	}))
+	context.Start()
+	component.send("test:in", NewTextMessage("hello"))
+	context.Stop()
+
+	assert.Equal(t, []string{
+		"core.RouteAddedEvent",
+		"core.ContextStartingEvent",
+		"core.RouteStartedEvent",
+		"core.ContextStartedEvent",
+		"core.ExchangeCreatedEvent",
+		"core.ExchangeSentEvent",
+		"core.ExchangeCompletedEvent",
+		"core.ContextStoppingEvent",
+		"core.RouteStoppedEvent",
+		"core.ContextStoppedEvent",
+	}, recorder.types())
+
+	added := recorder.events[0].(RouteAddedEvent)
+	assert.Equal(t, "route", added.Route.Id)
+	assert.False(t, added.Timestamp().IsZero())
+	sent := recorder.events[5].(ExchangeSentEvent)
+	assert.Equal(t, "route", sent.RouteId)
+	assert.Equal(t, "test:out", sent.Endpoint)
+	assert.True(t, sent.Duration >= 0)
+	assert.Equal(t, recorder.events[4].(ExchangeCreatedEvent).Exchange.Id(), sent.Exchange.Id())
+	assert.Equal(t, RouteStopped, recorder.events[8].(RouteStoppedEvent).Route.Status)
+}
+
+func TestEventNotifierFailures(t *testing.T) {
+	context, component := newTestContext()
+	events := make(chan Event, 20)
+	context.AddEventNotifier(EventNotifierFunction(func(event Event) {
+		events <- event
+	}))
+	component.handle("test:primary", func(exchange Exchange) {
+		exchange.SetError(errors.New("primary down"))
+	})
+	component.handle("test:secondary", func(exchange Exchange) {
+		exchange.SetError(errors.New("secondary down"))
+	})
+	assert.Nil(t, context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:in").RouteID("route").
+			LoadBalance().Failover().
+			ToS("test:primary").
+			ToS("test:secondary").
+			End()
+	}))
+	context.Start()
+	exchange := component.send("test:in", NewTextMessage("hello"))
+	close(events)
+
+	var redelivery ExchangeRedeliveryEvent
+	var failed ExchangeFailedEvent
+	sent := make([]string, 0)
+	for event := range events {
+		switch event := event.(type) {
+		case ExchangeRedeliveryEvent:
+			redelivery = event
+		case ExchangeFailedEvent:
+			failed = event
+		case ExchangeSentEvent:
+			sent = append(sent, event.Endpoint)
+		}
+	}
+	assert.Equal(t, []string{"test:primary", "test:secondary"}, sent)
+	assert.Equal(t, 1, redelivery.Attempt)
+	assert.EqualError(t, redelivery.Err, "primary down")
+	assert.Equal(t, "route", redelivery.RouteId)
+	assert.Equal(t, exchange, failed.Exchange)
+	assert.EqualError(t, failed.Err, "secondary down")
+}
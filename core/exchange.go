@@ -1,5 +1,7 @@
 package core
 
+import "sync"
+
 const (
 	// A RequestReplyExchange expects to send a Reply consumers the final Producer
 	// or Processor back to the original Consumer who sent it.
@@ -10,6 +12,34 @@ const (
 	RequestOnlyExchange = "RequestOnlyExchange"
 )
 
+// BreadcrumbHeader is the message header that a Consumer can set to
+// continue a breadcrumb that was started outside of Guancano. When
+// the header is present on the message that starts an exchange its
+// value is used as the breadcrumb id of the exchange.
+const BreadcrumbHeader = "breadcrumbId"
+
+// CompletionMode controls when a completion callback registered on an
+// Exchange is invoked.
+type CompletionMode int
+
+const (
+	// CompleteAlways invokes the callback whether the exchange succeeded
+	// or failed.
+	CompleteAlways CompletionMode = iota
+
+	// CompleteOnSuccess invokes the callback only if the exchange finished
+	// without an error.
+	CompleteOnSuccess
+
+	// CompleteOnFailure invokes the callback only if the exchange finished
+	// with an error.
+	CompleteOnFailure
+)
+
+// A CompletionFunction is called when an Exchange has finished routing. The
+// error is the error the exchange failed with or nil if it succeeded.
+type CompletionFunction func(exchange Exchange, err error)
+
 // Exchange is an exchange between two Services that encapsulates
 // all of the information about the Exchange and allows sending
 // to the next step by setting the Reply message.
@@ -19,6 +49,18 @@ type Exchange interface {
 	// throughout the entire routing lifecycle
 	Id() string
 
+	// ParentId is the Id of the exchange that created this exchange
+	// when it was handed to another route, such as through a direct
+	// endpoint. An exchange that was started by a Consumer has no
+	// parent and returns an empty string.
+	ParentId() string
+
+	// BreadcrumbId is shared by every exchange that was created on
+	// behalf of the same original exchange. It survives every hop
+	// between routes and can be used to trace a single transaction
+	// through all of the routes it touched.
+	BreadcrumbId() string
+
 	// Pattern is the type of exchange or the "exchange pattern". The
 	// valid values are Request/Reply which is also known as an In/Out
 	// Exchange and a Request Only exchange. In a Request/Reply Exchange
@@ -39,12 +81,56 @@ type Exchange interface {
 
 	// Properties (such as configuration or metadata) of the
 	// Exchange. Exchange properties are not intended to be
-	// mutated by Service implementations.
+	// mutated by Service implementations. A child exchange starts
+	// with a copy of the properties of its parent so properties
+	// set in a child are not visible to the parent.
 	Properties() map[string]interface{}
 
+	// Error is the error that caused the exchange to fail or nil
+	// if the exchange has not failed.
+	Error() error
+
+	// SetError marks the exchange as failed. The remaining steps
+	// of the route are not run once an error has been set.
+	SetError(err error)
+
+	// AddOnCompletion registers a callback that is invoked once the
+	// exchange has finished routing, whether it succeeded or failed.
+	AddOnCompletion(callback CompletionFunction)
+
+	// AddOnCompletionWhen registers a callback that is invoked once the
+	// exchange has finished routing if the outcome matches the mode.
+	AddOnCompletionWhen(mode CompletionMode, callback CompletionFunction)
+
 	// Rotate the out messge to the in message and nil out the
 	// out message for passing on to the next step
 	rotate()
+
+	// Run the completion callbacks that match the outcome of the
+	// exchange. Callbacks are only ever run once. If the exchange is
+	// held then the callbacks run when the last hold is released.
+	complete()
+
+	// hold keeps the exchange from completing until the returned function
+	// is called with the result of work done on another goroutine. The
+	// completion callbacks registered on the result are moved to the
+	// exchange and an error of the result fails the exchange, so that the
+	// callbacks see the outcome of all of the work. A nil result releases
+	// the hold without changing the exchange.
+	hold() func(result Exchange)
+
+	// addBeforeCompletion registers a callback that is run before any of
+	// the completion callbacks when the exchange completes, so that it can
+	// still fail the exchange, such as when a transaction fails to commit.
+	addBeforeCompletion(callback CompletionFunction)
+
+	// addAfterCompletion registers a callback that is run after all of the
+	// completion callbacks, such as to report the final outcome.
+	addAfterCompletion(callback CompletionFunction)
+
+	// Create a copy of the exchange that shares the messages and
+	// properties but none of the error or completion state
+	copy() Exchange
 }
 
 func NewExchange() Exchange {
@@ -57,27 +143,85 @@ func NewExchangeWithPattern(pattern string) Exchange {
 	if pattern != RequestReplyExchange {
 		pattern = RequestOnlyExchange
 	}
+	id := generator.Hex128()
 	return &exchange{
-		id:         generator.Hex128(),
-		pattern:    pattern,
-		in:         nil,
-		out:        nil,
-		properties: make(map[string]interface{}),
+		id:           id,
+		breadcrumbId: id,
+		pattern:      pattern,
+		in:           nil,
+		out:          nil,
+		properties:   make(map[string]interface{}),
+	}
+}
+
+// newChildExchange creates an exchange for handing the in message of the
+// parent to another route. The child has its own id but keeps the parent's
+// breadcrumb and starts with a copy of the parent's properties.
+func newChildExchange(parent Exchange, pattern string) Exchange {
+	child := NewExchangeWithPattern(pattern).(*exchange)
+	child.parentId = parent.Id()
+	child.breadcrumbId = parent.BreadcrumbId()
+	for key, value := range parent.Properties() {
+		child.properties[key] = value
 	}
+	child.in = parent.In()
+	return child
+}
+
+// newCopiedExchange creates a child of the parent with a copy of its in
+// message so that the child can be changed independently of the parent
+// and of any other copies.
+func newCopiedExchange(parent Exchange) Exchange {
+	child := newChildExchange(parent, parent.Pattern()).(*exchange)
+	child.in = CopyMessage(parent.In())
+	return child
+}
+
+type synchronization struct {
+	mode     CompletionMode
+	callback CompletionFunction
 }
 
 type exchange struct {
-	id         string
-	pattern    string
-	in         Message
-	out        Message
-	properties map[string]interface{}
+	id           string
+	parentId     string
+	breadcrumbId string
+	pattern      string
+	in           Message
+	out          Message
+	properties   map[string]interface{}
+	// lock guards the error and the completion state, which can be
+	// changed by work holding the exchange on another goroutine
+	lock             sync.Mutex
+	err              error
+	synchronizations []synchronization
+
+	// beforeCompletions run before the synchronizations and decide the
+	// outcome that the synchronizations see, afterCompletions run once
+	// all of the synchronizations have
+	beforeCompletions []CompletionFunction
+	afterCompletions  []CompletionFunction
+
+	// holds counts the work that the completion of the exchange waits
+	// for, completing is set when the exchange completed while held and
+	// heldErr is the first error of the work holding it
+	holds      int
+	completing bool
+	heldErr    error
 }
 
 func (e *exchange) Id() string {
 	return e.id
 }
 
+func (e *exchange) ParentId() string {
+	return e.parentId
+}
+
+func (e *exchange) BreadcrumbId() string {
+	return e.breadcrumbId
+}
+
 func (e *exchange) Pattern() string {
 	return e.pattern
 }
@@ -94,6 +238,34 @@ func (e *exchange) Properties() map[string]interface{} {
 	return e.properties
 }
 
+func (e *exchange) Error() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.err
+}
+
+func (e *exchange) SetError(err error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.err = err
+}
+
+func (e *exchange) AddOnCompletion(callback CompletionFunction) {
+	e.AddOnCompletionWhen(CompleteAlways, callback)
+}
+
+func (e *exchange) AddOnCompletionWhen(mode CompletionMode, callback CompletionFunction) {
+	if callback == nil {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.synchronizations = append(e.synchronizations, synchronization{
+		mode:     mode,
+		callback: callback,
+	})
+}
+
 func (e *exchange) rotate() {
 	// if there is no out to rotate to the new in
 	// then keep the old in
@@ -102,3 +274,124 @@ func (e *exchange) rotate() {
 		e.out = nil
 	}
 }
+
+func (e *exchange) addBeforeCompletion(callback CompletionFunction) {
+	if callback == nil {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.beforeCompletions = append(e.beforeCompletions, callback)
+}
+
+func (e *exchange) addAfterCompletion(callback CompletionFunction) {
+	if callback == nil {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.afterCompletions = append(e.afterCompletions, callback)
+}
+
+func (e *exchange) hold() func(result Exchange) {
+	e.lock.Lock()
+	e.holds++
+	e.lock.Unlock()
+
+	var once sync.Once
+	return func(result Exchange) {
+		once.Do(func() {
+			var err error
+			var before, after []CompletionFunction
+			var synchronizations []synchronization
+			if result != nil {
+				from := result.(*exchange)
+				from.lock.Lock()
+				err = from.err
+				before, synchronizations, after = from.beforeCompletions, from.synchronizations, from.afterCompletions
+				from.beforeCompletions, from.synchronizations, from.afterCompletions = nil, nil, nil
+				from.lock.Unlock()
+			}
+
+			e.lock.Lock()
+			e.heldErr = firstError(e.heldErr, err)
+			e.beforeCompletions = append(e.beforeCompletions, before...)
+			e.synchronizations = append(e.synchronizations, synchronizations...)
+			e.afterCompletions = append(e.afterCompletions, after...)
+			e.holds--
+			finish := e.holds == 0 && e.completing
+			e.lock.Unlock()
+
+			if finish {
+				e.finish()
+			}
+		})
+	}
+}
+
+func (e *exchange) complete() {
+	e.lock.Lock()
+	if e.holds > 0 {
+		e.completing = true
+		e.lock.Unlock()
+		return
+	}
+	e.lock.Unlock()
+	e.finish()
+}
+
+// finish runs the completion callbacks once the exchange and the work
+// holding it have finished
+func (e *exchange) finish() {
+	// take the callbacks off of the exchange so that they are not
+	// run twice if the exchange is completed again
+	e.lock.Lock()
+	e.err = firstError(e.err, e.heldErr)
+	e.heldErr = nil
+	e.completing = false
+	beforeCompletions := e.beforeCompletions
+	e.beforeCompletions = nil
+	e.lock.Unlock()
+	for _, callback := range beforeCompletions {
+		callback(e, e.Error())
+	}
+
+	e.lock.Lock()
+	synchronizations := e.synchronizations
+	e.synchronizations = nil
+	e.lock.Unlock()
+	for _, s := range synchronizations {
+		err := e.Error()
+		if s.mode == CompleteOnSuccess && err != nil {
+			continue
+		}
+		if s.mode == CompleteOnFailure && err == nil {
+			continue
+		}
+		s.callback(e, err)
+	}
+
+	e.lock.Lock()
+	afterCompletions := e.afterCompletions
+	e.afterCompletions = nil
+	e.lock.Unlock()
+	for _, callback := range afterCompletions {
+		callback(e, e.Error())
+	}
+}
+
+func (e *exchange) copy() Exchange {
+	properties := make(map[string]interface{}, len(e.properties))
+	for key, value := range e.properties {
+		properties[key] = value
+	}
+	return &exchange{
+		id:           e.id,
+		parentId:     e.parentId,
+		breadcrumbId: e.breadcrumbId,
+		pattern:      e.pattern,
+		in:           e.in,
+		out:          e.out,
+		properties:   properties,
+	}
+}
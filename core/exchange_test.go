@@ -0,0 +1,41 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreadcrumbHeader(t *testing.T) {
+	context, component := newTestContext()
+
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").ToS("test:out")
+	})
+	context.Start()
+
+	exchange := component.send("test:start", NewTextMessage("no header"))
+	assert.Equal(t, exchange.Id(), exchange.BreadcrumbId())
+
+	message := NewTextMessage("header")
+	(*message.Headers())[BreadcrumbHeader] = "upstream"
+	exchange = component.send("test:start", message)
+	assert.NotEqual(t, exchange.Id(), exchange.BreadcrumbId())
+	assert.Equal(t, "upstream", exchange.BreadcrumbId())
+}
+
+func TestChildExchange(t *testing.T) {
+	parent := NewExchange()
+	parent.Out(NewTextMessage("parent"))
+	parent.rotate()
+	parent.Properties()["key"] = "value"
+
+	child := newChildExchange(parent, RequestReplyExchange)
+	assert.Equal(t, parent.Id(), child.ParentId())
+	assert.Equal(t, parent.BreadcrumbId(), child.BreadcrumbId())
+	assert.Equal(t, RequestReplyExchange, child.Pattern())
+	assert.Equal(t, parent.In(), child.In())
+
+	child.Properties()["key"] = "changed"
+	assert.Equal(t, "value", parent.Properties()["key"])
+}
@@ -0,0 +1,32 @@
+package core
+
+// An Expression is evaluated against an Exchange to compute a value
+// that is used when routing it, such as a list of endpoints or a key.
+type Expression func(exchange Exchange) interface{}
+
+// Header returns an Expression that evaluates to the value of the header
+// on the in message or nil if it is not set.
+func Header(name string) Expression {
+	return func(exchange Exchange) interface{} {
+		in := exchange.In()
+		if in == nil || in.Headers() == nil {
+			return nil
+		}
+		return (*in.Headers())[name]
+	}
+}
+
+// Property returns an Expression that evaluates to the value of the
+// exchange property or nil if it is not set.
+func Property(name string) Expression {
+	return func(exchange Exchange) interface{} {
+		return exchange.Properties()[name]
+	}
+}
+
+// Constant returns an Expression that always evaluates to the value.
+func Constant(value interface{}) Expression {
+	return func(exchange Exchange) interface{} {
+		return value
+	}
+}
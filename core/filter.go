@@ -0,0 +1,58 @@
+package core
+
+// FilterMatchedProperty is the exchange property set by a Filter to
+// record whether the exchange matched the filter predicate.
+const FilterMatchedProperty = "FilterMatched"
+
+// filter is the block opened by RouteConfiguration.Filter. Only exchanges
+// that match the predicate are passed through the steps of the block and
+// the others are optionally handed to a rejected producer instead.
+type filter struct {
+	predicate  Predicate
+	processors pipeline
+	rejected   Producer
+}
+
+func (f *filter) add(processor Processor) {
+	f.processors = append(f.processors, processor)
+}
+
+func (f *filter) Process(exchange Exchange) {
+	matched := f.predicate(exchange)
+	exchange.Properties()[FilterMatchedProperty] = matched
+	if matched {
+		f.processors.Process(exchange)
+		return
+	}
+	if f.rejected != nil {
+		f.rejected.Process(exchange)
+	}
+}
+
+func (f *filter) Init() {
+	f.processors.Init()
+	if f.rejected != nil {
+		f.rejected.Init()
+	}
+}
+
+func (f *filter) Start() {
+	f.processors.Start()
+	if f.rejected != nil {
+		f.rejected.Start()
+	}
+}
+
+func (f *filter) Stop() {
+	f.processors.Stop()
+	if f.rejected != nil {
+		f.rejected.Stop()
+	}
+}
+
+func (f *filter) Close() {
+	f.processors.Close()
+	if f.rejected != nil {
+		f.rejected.Close()
+	}
+}
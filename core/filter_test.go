@@ -0,0 +1,44 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter(t *testing.T) {
+	context, component := newTestContext()
+
+	matched := make([]interface{}, 0)
+
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").
+			Filter(HeaderEquals("type", "llama")).
+			ToS("test:llamas").
+			End().
+			ProcessFunction(func(exchange Exchange) {
+				matched = append(matched, exchange.Properties()[FilterMatchedProperty])
+			}).
+			ToS("test:all")
+
+		builder.FromS("test:reject").
+			FilterRejectS(Not(HeaderEquals("type", "vicuna")), "test:vicunas").
+			ToS("test:accepted").
+			End()
+	})
+	context.Start()
+
+	for _, kind := range []string{"llama", "vicuna", "llama"} {
+		message := NewTextMessage(kind)
+		(*message.Headers())["type"] = kind
+		component.send("test:start", message)
+		component.send("test:reject", message)
+	}
+
+	assert.Equal(t, 2, len(component.received["test:llamas"]))
+	assert.Equal(t, 3, len(component.received["test:all"]))
+	assert.Equal(t, []interface{}{true, false, true}, matched)
+
+	assert.Equal(t, 2, len(component.received["test:accepted"]))
+	assert.Equal(t, 1, len(component.received["test:vicunas"]))
+}
@@ -0,0 +1,133 @@
+package core
+
+import "fmt"
+
+// DuplicateMessageProperty is the exchange property set to true by an
+// Idempotent block that flags duplicates instead of skipping them.
+const DuplicateMessageProperty = "DuplicateMessage"
+
+// MissingIdempotentKey is the error set on an exchange when the key
+// expression of an Idempotent block evaluates to nil.
+type MissingIdempotentKey struct {
+}
+
+func (m MissingIdempotentKey) Error() string {
+	return fmt.Sprint("The idempotent key expression did not evaluate to a key")
+}
+
+// An IdempotentRepository remembers the keys of the exchanges that have
+// already been processed by an Idempotent block.
+type IdempotentRepository interface {
+	// Add the key to the repository and return false if the key was
+	// already in the repository.
+	Add(key string) (bool, error)
+
+	// Contains returns true if the key is in the repository.
+	Contains(key string) (bool, error)
+
+	// Remove the key from the repository so that an exchange with the
+	// same key is processed again.
+	Remove(key string) error
+
+	// Confirm that the exchange for a key that was added has finished
+	// processing successfully.
+	Confirm(key string) error
+}
+
+// IdempotentOptions configure how an Idempotent block uses its repository.
+type IdempotentOptions struct {
+	// Lazy only adds the key to the repository once the exchange has
+	// completed successfully instead of as soon as it arrives. Lazy
+	// adds let a failed exchange be retried but do not stop duplicates
+	// that arrive while the first exchange is still being processed.
+	Lazy bool
+
+	// KeepOnFailure keeps the key in the repository when the exchange
+	// fails instead of removing it so that it can be retried.
+	KeepOnFailure bool
+
+	// FlagDuplicates runs duplicates through the block with the
+	// DuplicateMessageProperty set instead of skipping the block.
+	FlagDuplicates bool
+}
+
+// idempotent is the block opened by RouteConfiguration.Idempotent. The
+// repository is updated when the exchange completes, so a failure after
+// the block still removes the key.
+type idempotent struct {
+	key        Expression
+	repository IdempotentRepository
+	options    IdempotentOptions
+	processors pipeline
+}
+
+func (i *idempotent) add(processor Processor) {
+	i.processors = append(i.processors, processor)
+}
+
+func (i *idempotent) Process(exchange Exchange) {
+	value := i.key(exchange)
+	if value == nil {
+		exchange.SetError(MissingIdempotentKey{})
+		return
+	}
+	key := fmt.Sprint(value)
+
+	var duplicate bool
+	var err error
+	if i.options.Lazy {
+		duplicate, err = i.repository.Contains(key)
+	} else {
+		var added bool
+		added, err = i.repository.Add(key)
+		duplicate = !added
+	}
+	if err != nil {
+		exchange.SetError(err)
+		return
+	}
+
+	if duplicate {
+		if !i.options.FlagDuplicates {
+			return
+		}
+		exchange.Properties()[DuplicateMessageProperty] = true
+		i.processors.Process(exchange)
+		return
+	}
+
+	exchange.AddOnCompletion(func(exchange Exchange, failure error) {
+		i.completed(key, failure)
+	})
+	i.processors.Process(exchange)
+}
+
+func (i *idempotent) completed(key string, failure error) {
+	// todo: log repository errors (waiting on choosing a log framework)
+	if failure != nil {
+		if !i.options.Lazy && !i.options.KeepOnFailure {
+			_ = i.repository.Remove(key)
+		}
+		return
+	}
+	if i.options.Lazy {
+		_, _ = i.repository.Add(key)
+	}
+	_ = i.repository.Confirm(key)
+}
+
+func (i *idempotent) Init() {
+	i.processors.Init()
+}
+
+func (i *idempotent) Start() {
+	i.processors.Start()
+}
+
+func (i *idempotent) Stop() {
+	i.processors.Stop()
+}
+
+func (i *idempotent) Close() {
+	i.processors.Close()
+}
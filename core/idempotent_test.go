@@ -0,0 +1,133 @@
+package core
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sendWithId(component *testComponent, path string, id string) Exchange {
+	message := NewTextMessage(id)
+	(*message.Headers())["id"] = id
+	return component.send(path, message)
+}
+
+func TestIdempotent(t *testing.T) {
+	context, component := newTestContext()
+	component.handle("test:fails", func(exchange Exchange) {
+		if exchange.In().Body() == "bad" {
+			exchange.SetError(errors.New("failed"))
+		}
+	})
+
+	flagged := make([]interface{}, 0)
+
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:skip").
+			Idempotent(Header("id"), NewMemoryIdempotentRepository(0, 0)).
+			ToS("test:once").
+			End().
+			ToS("test:fails")
+
+		builder.FromS("test:flag").
+			IdempotentWith(Header("id"), NewMemoryIdempotentRepository(0, 0), IdempotentOptions{FlagDuplicates: true}).
+			ProcessFunction(func(exchange Exchange) {
+				flagged = append(flagged, exchange.Properties()[DuplicateMessageProperty])
+			}).
+			End()
+	})
+	context.Start()
+
+	sendWithId(component, "test:skip", "a")
+	sendWithId(component, "test:skip", "a")
+	sendWithId(component, "test:skip", "b")
+	assert.Equal(t, 2, component.count("test:once"))
+
+	// a failure after the block removes the key so it can be retried
+	exchange := sendWithId(component, "test:skip", "bad")
+	assert.NotNil(t, exchange.Error())
+	sendWithId(component, "test:skip", "bad")
+	assert.Equal(t, 4, component.count("test:once"))
+
+	sendWithId(component, "test:flag", "a")
+	sendWithId(component, "test:flag", "a")
+	assert.Equal(t, []interface{}{nil, true}, flagged)
+
+	exchange = component.send("test:skip", NewTextMessage("no id"))
+	assert.IsType(t, MissingIdempotentKey{}, exchange.Error())
+}
+
+func TestMemoryIdempotentRepository(t *testing.T) {
+	repository := NewMemoryIdempotentRepository(2, time.Minute).(*memoryIdempotentRepository)
+	now := time.Now()
+	repository.now = func() time.Time { return now }
+
+	added, _ := repository.Add("a")
+	assert.True(t, added)
+	added, _ = repository.Add("a")
+	assert.False(t, added)
+
+	// b is the least recently used when c arrives
+	repository.Add("b")
+	repository.Add("a")
+	repository.Add("c")
+	contains, _ := repository.Contains("b")
+	assert.False(t, contains)
+	contains, _ = repository.Contains("a")
+	assert.True(t, contains)
+
+	now = now.Add(2 * time.Minute)
+	contains, _ = repository.Contains("a")
+	assert.False(t, contains)
+}
+
+func TestFileIdempotentRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idempotent")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keys")
+
+	repository, err := NewFileIdempotentRepository(path)
+	assert.Nil(t, err)
+	repository.Add("a")
+	repository.Add("multi\nline")
+	repository.Add("c")
+	assert.Nil(t, repository.Remove("c"))
+
+	// a new repository on the same file sees the keys
+	reopened, err := NewFileIdempotentRepository(path)
+	assert.Nil(t, err)
+	contains, _ := reopened.Contains("a")
+	assert.True(t, contains)
+	contains, _ = reopened.Contains("multi\nline")
+	assert.True(t, contains)
+	contains, _ = reopened.Contains("c")
+	assert.False(t, contains)
+}
+
+func TestFileIdempotentRepositoryFailedRemove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idempotent")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keys")
+
+	repository, err := NewFileIdempotentRepository(path)
+	assert.Nil(t, err)
+	repository.Add("a")
+
+	// the file cannot be rewritten so the key is kept
+	assert.Nil(t, os.Mkdir(path+".tmp", 0755))
+	assert.NotNil(t, repository.Remove("a"))
+	contains, _ := repository.Contains("a")
+	assert.True(t, contains)
+
+	assert.Nil(t, os.Remove(path+".tmp"))
+	assert.Nil(t, repository.Remove("a"))
+	contains, _ = repository.Contains("a")
+	assert.False(t, contains)
+}
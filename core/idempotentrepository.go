@@ -0,0 +1,187 @@
+package core
+
+import (
+	"bufio"
+	"container/list"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewMemoryIdempotentRepository creates an IdempotentRepository that keeps
+// at most capacity keys in memory and forgets the least recently used key
+// when it is full. Keys are also forgotten once they are older than the
+// ttl. A capacity or ttl of zero means there is no limit.
+func NewMemoryIdempotentRepository(capacity int, ttl time.Duration) IdempotentRepository {
+	return &memoryIdempotentRepository{
+		capacity: capacity,
+		ttl:      ttl,
+		keys:     make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+type memoryEntry struct {
+	key   string
+	added time.Time
+}
+
+type memoryIdempotentRepository struct {
+	lock     sync.Mutex
+	capacity int
+	ttl      time.Duration
+	keys     map[string]*list.Element
+	order    *list.List
+	now      func() time.Time
+}
+
+func (m *memoryIdempotentRepository) Add(key string) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.live(key) {
+		m.order.MoveToFront(m.keys[key])
+		return false, nil
+	}
+	m.keys[key] = m.order.PushFront(&memoryEntry{key: key, added: m.now()})
+	for m.capacity > 0 && m.order.Len() > m.capacity {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.keys, oldest.Value.(*memoryEntry).key)
+	}
+	return true, nil
+}
+
+func (m *memoryIdempotentRepository) Contains(key string) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.live(key), nil
+}
+
+func (m *memoryIdempotentRepository) Remove(key string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if element, found := m.keys[key]; found {
+		m.order.Remove(element)
+		delete(m.keys, key)
+	}
+	return nil
+}
+
+func (m *memoryIdempotentRepository) Confirm(key string) error {
+	return nil
+}
+
+// live returns true if the key is present and has not expired, removing it
+// if it has expired. The lock must be held.
+func (m *memoryIdempotentRepository) live(key string) bool {
+	element, found := m.keys[key]
+	if !found {
+		return false
+	}
+	if m.ttl > 0 && m.now().Sub(element.Value.(*memoryEntry).added) > m.ttl {
+		m.order.Remove(element)
+		delete(m.keys, key)
+		return false
+	}
+	return true
+}
+
+// NewFileIdempotentRepository creates an IdempotentRepository that keeps
+// its keys in a file so that they survive a restart. Any keys already in
+// the file are loaded when the repository is created. Each key is written
+// to its own line as a quoted string.
+func NewFileIdempotentRepository(path string) (IdempotentRepository, error) {
+	repository := &fileIdempotentRepository{
+		path: path,
+		keys: make(map[string]bool),
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return repository, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		key, err := strconv.Unquote(line)
+		if err != nil {
+			return nil, err
+		}
+		repository.keys[key] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return repository, nil
+}
+
+type fileIdempotentRepository struct {
+	lock sync.Mutex
+	path string
+	keys map[string]bool
+}
+
+func (f *fileIdempotentRepository) Add(key string) (bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.keys[key] {
+		return false, nil
+	}
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	if _, err := file.WriteString(strconv.Quote(key) + "\n"); err != nil {
+		return false, err
+	}
+	f.keys[key] = true
+	return true, nil
+}
+
+func (f *fileIdempotentRepository) Contains(key string) (bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.keys[key], nil
+}
+
+// Remove rewrites the file without the key.
+func (f *fileIdempotentRepository) Remove(key string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if !f.keys[key] {
+		return nil
+	}
+
+	// the key is only forgotten once the file no longer holds it
+	builder := strings.Builder{}
+	for remaining := range f.keys {
+		if remaining != key {
+			builder.WriteString(strconv.Quote(remaining) + "\n")
+		}
+	}
+	temp := f.path + ".tmp"
+	if err := ioutil.WriteFile(temp, []byte(builder.String()), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(temp, f.path); err != nil {
+		return err
+	}
+	delete(f.keys, key)
+	return nil
+}
+
+func (f *fileIdempotentRepository) Confirm(key string) error {
+	return nil
+}
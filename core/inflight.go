@@ -0,0 +1,100 @@
+package core
+
+import (
+	gocontext "context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultShutdownTimeout is how long Context.Stop and Context.StopRoute
+// wait for in-flight exchanges to complete before stopping the producers
+// of a route anyway.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// inflight is the registry of the exchanges a route is processing.
+type inflight struct {
+	lock      sync.Mutex
+	exchanges map[string]Exchange
+
+	// changed is closed and replaced each time an exchange completes
+	changed chan struct{}
+}
+
+func newInflight() *inflight {
+	return &inflight{
+		exchanges: make(map[string]Exchange),
+		changed:   make(chan struct{}),
+	}
+}
+
+func (i *inflight) add(exchange Exchange) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.exchanges[exchange.Id()] = exchange
+}
+
+func (i *inflight) remove(exchange Exchange) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	delete(i.exchanges, exchange.Id())
+	close(i.changed)
+	i.changed = make(chan struct{})
+}
+
+// wait until there are no exchanges in flight or the Go context is done,
+// returning the ids of the exchanges that were still in flight
+func (i *inflight) wait(ctx gocontext.Context) []string {
+	for {
+		i.lock.Lock()
+		if len(i.exchanges) == 0 {
+			i.lock.Unlock()
+			return nil
+		}
+		changed := i.changed
+		i.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return i.ids()
+		}
+	}
+}
+
+func (i *inflight) ids() []string {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	ids := make([]string, 0, len(i.exchanges))
+	for id := range i.exchanges {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// AbandonedExchanges is the error returned when a route is stopped before
+// all of its in-flight exchanges completed. The producers of the route are
+// stopped anyway, so the abandoned exchanges may fail.
+type AbandonedExchanges struct {
+	// Err is the error of the Go context that ended the wait.
+	Err error
+
+	// Exchanges are the ids of the abandoned exchanges by route id.
+	Exchanges map[string][]string
+}
+
+func (a AbandonedExchanges) Error() string {
+	routes := make([]string, 0, len(a.Exchanges))
+	for id, exchanges := range a.Exchanges {
+		routes = append(routes, fmt.Sprintf("%s (%d)", id, len(exchanges)))
+	}
+	sort.Strings(routes)
+	return fmt.Sprintf("Abandoned in-flight exchanges on routes %s: %v", strings.Join(routes, ", "), a.Err)
+}
+
+func (a AbandonedExchanges) Unwrap() error {
+	return a.Err
+}
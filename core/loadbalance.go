@@ -0,0 +1,223 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// A LoadBalancerBuilder selects the policy of the block opened by
+// RouteConfiguration.LoadBalance. Each policy returns the route
+// configuration with the block open so that the steps to balance
+// between can be added before End is called.
+type LoadBalancerBuilder interface {
+	// RoundRobin sends each exchange to the next step in turn.
+	RoundRobin() RouteConfiguration
+
+	// Random sends each exchange to a step picked at random.
+	Random() RouteConfiguration
+
+	// Weighted sends exchanges to the steps in turn in proportion to
+	// their weights so that weights of 3 and 1 send three exchanges to
+	// the first step for every one to the second. There must be one
+	// weight for each step of the block or Context.Add fails with
+	// InvalidLoadBalancer.
+	Weighted(weights ...int) RouteConfiguration
+
+	// Sticky always sends exchanges with the same key to the same step.
+	Sticky(key Expression) RouteConfiguration
+
+	// Failover sends each exchange to the first step and, when that step
+	// fails with one of the errors, to the next step until one succeeds.
+	// An error matches if errors.Is matches it, so errors can be sentinel
+	// values or comparable values such as structs without pointers. Every
+	// error fails over when no errors are given. Context.Add fails with
+	// InvalidLoadBalancer if one of the errors is nil.
+	Failover(errs ...error) RouteConfiguration
+
+	// FailoverWhen fails over like Failover for the errors that the
+	// function matches, such as with errors.As to match errors by type.
+	FailoverWhen(matches func(err error) bool) RouteConfiguration
+}
+
+// InvalidLoadBalancer is the error returned by Context.Add for a route
+// with a LoadBalance block that is configured incorrectly.
+type InvalidLoadBalancer struct {
+	Reason string
+}
+
+func (i InvalidLoadBalancer) Error() string {
+	return fmt.Sprintf("Invalid load balancer: %s", i.Reason)
+}
+
+type loadBalancerBuilder struct {
+	configuration *routeConfiguration
+}
+
+func (l *loadBalancerBuilder) RoundRobin() RouteConfiguration {
+	var counter uint64
+	return l.open(func(exchange Exchange, count int) int {
+		return int((atomic.AddUint64(&counter, 1) - 1) % uint64(count))
+	})
+}
+
+func (l *loadBalancerBuilder) Random() RouteConfiguration {
+	return l.open(func(exchange Exchange, count int) int {
+		return rand.Intn(count)
+	})
+}
+
+func (l *loadBalancerBuilder) Weighted(weights ...int) RouteConfiguration {
+	// each step appears in the distribution as many times as its weight
+	distribution := make([]int, 0)
+	for idx, weight := range weights {
+		for ; weight > 0; weight-- {
+			distribution = append(distribution, idx)
+		}
+	}
+	var counter uint64
+	balancer := l.balancer(func(exchange Exchange, count int) int {
+		if len(distribution) == 0 {
+			return 0
+		}
+		next := (atomic.AddUint64(&counter, 1) - 1) % uint64(len(distribution))
+		return distribution[next]
+	})
+	balancer.weights = len(weights)
+	return l.configuration.open(balancer)
+}
+
+func (l *loadBalancerBuilder) Sticky(key Expression) RouteConfiguration {
+	return l.open(func(exchange Exchange, count int) int {
+		hash := fnv.New32a()
+		_, _ = hash.Write([]byte(fmt.Sprint(key(exchange))))
+		return int(hash.Sum32() % uint32(count))
+	})
+}
+
+func (l *loadBalancerBuilder) Failover(errs ...error) RouteConfiguration {
+	for _, err := range errs {
+		if err == nil {
+			l.configuration.fail(InvalidLoadBalancer{Reason: "Failover cannot match a nil error"})
+		}
+	}
+	if len(errs) == 0 {
+		return l.FailoverWhen(nil)
+	}
+	return l.FailoverWhen(func(err error) bool {
+		for _, target := range errs {
+			if target != nil && errors.Is(err, target) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (l *loadBalancerBuilder) FailoverWhen(matches func(err error) bool) RouteConfiguration {
+	balancer := l.balancer(func(exchange Exchange, count int) int {
+		return 0
+	})
+	balancer.failover = true
+	balancer.matches = matches
+	return l.configuration.open(balancer)
+}
+
+func (l *loadBalancerBuilder) balancer(choose func(exchange Exchange, count int) int) *loadBalancer {
+	return &loadBalancer{
+		choose:     choose,
+		processors: make(pipeline, 0),
+		routeId:    &l.configuration.route.id,
+		events:     l.configuration.events,
+	}
+}
+
+func (l *loadBalancerBuilder) open(choose func(exchange Exchange, count int) int) RouteConfiguration {
+	return l.configuration.open(l.balancer(choose))
+}
+
+// loadBalancer is the block opened by a LoadBalancerBuilder. Each exchange
+// is sent to one of the steps of the block instead of all of them.
+type loadBalancer struct {
+	choose     func(exchange Exchange, count int) int
+	failover   bool
+	matches    func(err error) bool
+	processors pipeline
+	routeId    *string
+	events     *eventNotifiers
+
+	// weights is the number of weights of a Weighted balancer or 0
+	weights int
+}
+
+func (l *loadBalancer) add(processor Processor) {
+	l.processors = append(l.processors, processor)
+}
+
+func (l *loadBalancer) Process(exchange Exchange) {
+	count := len(l.processors)
+	if count == 0 {
+		return
+	}
+	first := l.choose(exchange, count)
+	if !l.failover {
+		l.processors[first].Process(exchange)
+		return
+	}
+
+	for attempt := 0; attempt < count; attempt++ {
+		if attempt > 0 {
+			if l.events.enabled() {
+				l.events.notify(ExchangeRedeliveryEvent{
+					BaseEvent: BaseEvent{Time: time.Now()},
+					RouteId:   *l.routeId,
+					Exchange:  exchange,
+					Attempt:   attempt,
+					Err:       exchange.Error(),
+				})
+			}
+			// discard the failed attempt before trying the next step
+			exchange.SetError(nil)
+			exchange.Out(nil)
+		}
+		l.processors[(first+attempt)%count].Process(exchange)
+		if exchange.Error() == nil || !l.failsOver(exchange.Error()) {
+			return
+		}
+	}
+}
+
+// failsOver returns true if the error is one that should be tried on the
+// next step
+func (l *loadBalancer) failsOver(err error) bool {
+	return l.matches == nil || l.matches(err)
+}
+
+// validate checks the balancer once its steps have been added
+func (l *loadBalancer) validate() error {
+	if l.weights > 0 && l.weights != len(l.processors) {
+		return InvalidLoadBalancer{
+			Reason: fmt.Sprintf("%d weights were given for %d steps", l.weights, len(l.processors)),
+		}
+	}
+	return nil
+}
+
+func (l *loadBalancer) Init() {
+	l.processors.Init()
+}
+
+func (l *loadBalancer) Start() {
+	l.processors.Start()
+}
+
+func (l *loadBalancer) Stop() {
+	l.processors.Stop()
+}
+
+func (l *loadBalancer) Close() {
+	l.processors.Close()
+}
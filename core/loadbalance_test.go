@@ -0,0 +1,157 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundRobin(t *testing.T) {
+	context, component := newTestContext()
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").LoadBalance().RoundRobin().ToS("test:a").ToS("test:b").ToS("test:c").End().ToS("test:after")
+	})
+	context.Start()
+
+	wg := sync.WaitGroup{}
+	for idx := 0; idx < 30; idx++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			component.send("test:start", NewTextMessage("hello"))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 10, component.count("test:a"))
+	assert.Equal(t, 10, component.count("test:b"))
+	assert.Equal(t, 10, component.count("test:c"))
+	assert.Equal(t, 30, component.count("test:after"))
+}
+
+func TestWeightedAndRandom(t *testing.T) {
+	context, component := newTestContext()
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:weighted").LoadBalance().Weighted(3, 1).ToS("test:a").ToS("test:b").End()
+		builder.FromS("test:random").LoadBalance().Random().ToS("test:c").ToS("test:d").End()
+	})
+	context.Start()
+
+	for idx := 0; idx < 40; idx++ {
+		component.send("test:weighted", NewTextMessage("hello"))
+		component.send("test:random", NewTextMessage("hello"))
+	}
+	assert.Equal(t, 30, component.count("test:a"))
+	assert.Equal(t, 10, component.count("test:b"))
+	assert.Equal(t, 40, component.count("test:c")+component.count("test:d"))
+}
+
+func TestSticky(t *testing.T) {
+	context, component := newTestContext()
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").LoadBalance().Sticky(Header("session")).ToS("test:a").ToS("test:b").End()
+	})
+	context.Start()
+
+	for idx := 0; idx < 10; idx++ {
+		message := NewTextMessage("hello")
+		(*message.Headers())["session"] = "llama"
+		component.send("test:start", message)
+	}
+	counts := []int{component.count("test:a"), component.count("test:b")}
+	assert.Contains(t, counts, 10)
+	assert.Contains(t, counts, 0)
+}
+
+type unavailable struct {
+	replica string
+}
+
+func (u unavailable) Error() string {
+	return fmt.Sprintf("%s is unavailable", u.replica)
+}
+
+func TestFailover(t *testing.T) {
+	context, component := newTestContext()
+	rejected := errors.New("rejected")
+	component.handle("test:down", func(exchange Exchange) {
+		exchange.Out(NewTextMessage("partial"))
+		exchange.SetError(fmt.Errorf("calling replica: %w", unavailable{replica: "down"}))
+	})
+	component.handle("test:up", func(exchange Exchange) {
+		exchange.Out(NewTextMessage("reply"))
+	})
+	component.handle("test:rejects", func(exchange Exchange) {
+		exchange.SetError(rejected)
+	})
+
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:typed").RequestReply().
+			LoadBalance().FailoverWhen(func(err error) bool {
+			var target unavailable
+			return errors.As(err, &target)
+		}).ToS("test:down").ToS("test:up").End()
+		builder.FromS("test:sentinel").RequestReply().
+			LoadBalance().Failover(rejected).ToS("test:rejects").ToS("test:up").End()
+		builder.FromS("test:unmatched").RequestReply().
+			LoadBalance().Failover(rejected).ToS("test:down").ToS("test:up").End()
+	})
+	context.Start()
+
+	exchange := component.send("test:typed", NewTextMessage("hello"))
+	assert.Nil(t, exchange.Error())
+	assert.Equal(t, "reply", exchange.In().Body())
+	assert.Equal(t, "hello", component.received["test:up"][0].Body())
+
+	exchange = component.send("test:sentinel", NewTextMessage("hello"))
+	assert.Nil(t, exchange.Error())
+
+	exchange = component.send("test:unmatched", NewTextMessage("hello"))
+	assert.NotNil(t, exchange.Error())
+	assert.Equal(t, 2, component.count("test:up"))
+}
+
+func TestFailoverDistinctSentinels(t *testing.T) {
+	context, component := newTestContext()
+	rejected := errors.New("rejected")
+	component.handle("test:down", func(exchange Exchange) {
+		exchange.SetError(errors.New("down"))
+	})
+
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").
+			LoadBalance().Failover(rejected).ToS("test:down").ToS("test:up").End()
+	})
+	context.Start()
+
+	exchange := component.send("test:start", NewTextMessage("hello"))
+	assert.EqualError(t, exchange.Error(), "down")
+	assert.Equal(t, 0, component.count("test:up"))
+}
+
+func TestInvalidLoadBalancer(t *testing.T) {
+	context, _ := newTestContext()
+
+	err := context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").
+			LoadBalance().Failover(nil).ToS("test:a").ToS("test:b").End()
+	})
+	assert.IsType(t, InvalidLoadBalancer{}, err)
+
+	err = context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").
+			LoadBalance().Weighted(3, 1).ToS("test:a").ToS("test:b").ToS("test:c").End()
+	})
+	assert.Equal(t, InvalidLoadBalancer{Reason: "2 weights were given for 3 steps"}, err)
+
+	// blocks that are not closed are validated when the route is built
+	err = context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").
+			LoadBalance().Weighted(3, 1).ToS("test:a")
+	})
+	assert.IsType(t, InvalidLoadBalancer{}, err)
+	assert.Equal(t, 0, len(context.Routes()))
+}
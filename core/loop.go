@@ -0,0 +1,136 @@
+package core
+
+import "fmt"
+
+// DefaultLoopMaxIterations is the most iterations a LoopWhile block runs
+// when its options do not set MaxIterations.
+const DefaultLoopMaxIterations = 1000
+
+const (
+	// LoopIndexProperty is the exchange property holding the zero based
+	// iteration of the innermost Loop block that is running. When a nested
+	// loop ends it holds the iteration of the loop around it again.
+	LoopIndexProperty = "LoopIndex"
+
+	// LoopSizeProperty is the exchange property holding the number of
+	// iterations of a Loop block with a count. It is not set while a
+	// LoopWhile block runs because the number is not known.
+	LoopSizeProperty = "LoopSize"
+
+	// loopDepthProperty is the number of Loop blocks that are running so
+	// that a nested loop knows to give the properties of the loop around
+	// it back once it ends
+	loopDepthProperty = "LoopDepth"
+)
+
+// LoopOptions configure a Loop block.
+type LoopOptions struct {
+	// Copy starts each iteration with a copy of the message the exchange
+	// had when it arrived at the loop instead of the result of the last
+	// iteration. The result of the final iteration is kept either way.
+	Copy bool
+
+	// MaxIterations is the most iterations a LoopWhile block runs before
+	// the exchange fails with LoopLimitExceeded, DefaultLoopMaxIterations
+	// if it is not set. It is ignored by Loop blocks with a count.
+	MaxIterations int
+}
+
+// LoopLimitExceeded is the error set on an exchange when the predicate of a
+// LoopWhile block still matches after the most iterations it may run.
+type LoopLimitExceeded struct {
+	Iterations int
+}
+
+func (l LoopLimitExceeded) Error() string {
+	return fmt.Sprintf("The loop did not end within %d iterations", l.Iterations)
+}
+
+// loop is the block opened by RouteConfiguration.Loop and LoopWhile. The
+// steps of the block are run a fixed number of times or for as long as the
+// predicate matches, stopping early if the exchange fails.
+type loop struct {
+	count      int
+	predicate  Predicate
+	options    LoopOptions
+	processors pipeline
+}
+
+func (l *loop) add(processor Processor) {
+	l.processors = append(l.processors, processor)
+}
+
+func (l *loop) Process(exchange Exchange) {
+	properties := exchange.Properties()
+	depth, _ := properties[loopDepthProperty].(int)
+	properties[loopDepthProperty] = depth + 1
+	if depth > 0 {
+		defer restoreProperty(properties, LoopIndexProperty)()
+		defer restoreProperty(properties, LoopSizeProperty)()
+	}
+	defer func() {
+		if depth > 0 {
+			properties[loopDepthProperty] = depth
+		} else {
+			delete(properties, loopDepthProperty)
+		}
+	}()
+
+	original := exchange.In()
+	if l.predicate == nil {
+		exchange.Properties()[LoopSizeProperty] = l.count
+	} else {
+		delete(properties, LoopSizeProperty)
+	}
+	for index := 0; l.continues(exchange, index); index++ {
+		if l.predicate != nil && index >= l.options.MaxIterations {
+			exchange.SetError(LoopLimitExceeded{Iterations: l.options.MaxIterations})
+			return
+		}
+		if l.options.Copy {
+			exchange.Out(CopyMessage(original))
+			exchange.rotate()
+		}
+		exchange.Properties()[LoopIndexProperty] = index
+		l.processors.Process(exchange)
+		if exchange.Error() != nil {
+			return
+		}
+	}
+}
+
+// restoreProperty returns a function that sets the property back to the value it
+// has now, or removes it if it is not set
+func restoreProperty(properties map[string]interface{}, key string) func() {
+	value, found := properties[key]
+	return func() {
+		if found {
+			properties[key] = value
+		} else {
+			delete(properties, key)
+		}
+	}
+}
+
+func (l *loop) continues(exchange Exchange, index int) bool {
+	if l.predicate != nil {
+		return l.predicate(exchange)
+	}
+	return index < l.count
+}
+
+func (l *loop) Init() {
+	l.processors.Init()
+}
+
+func (l *loop) Start() {
+	l.processors.Start()
+}
+
+func (l *loop) Stop() {
+	l.processors.Stop()
+}
+
+func (l *loop) Close() {
+	l.processors.Close()
+}
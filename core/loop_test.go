@@ -0,0 +1,152 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func appendIndex(exchange Exchange) {
+	body := exchange.In().Body().(string)
+	exchange.Out(NewTextMessage(body + string(rune('0'+exchange.Properties()[LoopIndexProperty].(int)))))
+}
+
+func TestLoop(t *testing.T) {
+	context, component := newTestContext()
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:carry").RequestReply().Loop(3).ProcessFunction(appendIndex).ToS("test:each").End()
+		builder.FromS("test:copy").RequestReply().LoopWith(3, LoopOptions{Copy: true}).ProcessFunction(appendIndex).End()
+		builder.FromS("test:fail").Loop(5).ProcessFunction(func(exchange Exchange) {
+			if exchange.Properties()[LoopIndexProperty] == 1 {
+				exchange.SetError(errors.New("failed"))
+			}
+		}).ToS("test:attempts").End()
+	})
+	context.Start()
+
+	exchange := component.send("test:carry", NewTextMessage("page"))
+	assert.Equal(t, "page012", exchange.In().Body())
+	assert.Equal(t, 3, exchange.Properties()[LoopSizeProperty])
+	assert.Equal(t, 3, component.count("test:each"))
+
+	exchange = component.send("test:copy", NewTextMessage("page"))
+	assert.Equal(t, "page2", exchange.In().Body())
+
+	exchange = component.send("test:fail", NewTextMessage("page"))
+	assert.NotNil(t, exchange.Error())
+	assert.Equal(t, 1, component.count("test:attempts"))
+}
+
+func TestLoopWhile(t *testing.T) {
+	context, component := newTestContext()
+	pages := 4
+	component.handle("test:partner", func(exchange Exchange) {
+		page := exchange.Properties()[LoopIndexProperty].(int) + 1
+		message := NewTextMessage("page")
+		(*message.Headers())["more"] = page < pages
+		exchange.Out(message)
+	})
+
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").
+			ProcessFunction(func(exchange Exchange) {
+				(*exchange.In().Headers())["more"] = true
+			}).
+			LoopWhile(HeaderEquals("more", true)).
+			ToS("test:partner").
+			End()
+	})
+	context.Start()
+
+	component.send("test:start", NewTextMessage("first"))
+	assert.Equal(t, pages, component.count("test:partner"))
+}
+
+func TestNestedLoop(t *testing.T) {
+	context, component := newTestContext()
+	visits := make([]string, 0)
+	visit := func(name string) ProcessingFunction {
+		return func(exchange Exchange) {
+			visits = append(visits, fmt.Sprintf("%s%d/%d", name,
+				exchange.Properties()[LoopIndexProperty], exchange.Properties()[LoopSizeProperty]))
+		}
+	}
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").
+			Loop(2).
+			Loop(3).
+			ProcessFunction(visit("inner")).
+			End().
+			ProcessFunction(visit("outer")).
+			End()
+	})
+	context.Start()
+
+	exchange := component.send("test:start", NewTextMessage("hello"))
+	assert.Equal(t, []string{
+		"inner0/3", "inner1/3", "inner2/3", "outer0/2",
+		"inner0/3", "inner1/3", "inner2/3", "outer1/2",
+	}, visits)
+	assert.Equal(t, 1, exchange.Properties()[LoopIndexProperty])
+	assert.Equal(t, 2, exchange.Properties()[LoopSizeProperty])
+}
+
+func TestLoopWhileInsideLoop(t *testing.T) {
+	context, component := newTestContext()
+	visits := make([]string, 0)
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").
+			Loop(2).
+			ProcessFunction(func(exchange Exchange) {
+				exchange.Properties()["remaining"] = 2
+			}).
+			LoopWhile(func(exchange Exchange) bool {
+				return exchange.Properties()["remaining"].(int) > 0
+			}).
+			ProcessFunction(func(exchange Exchange) {
+				exchange.Properties()["remaining"] = exchange.Properties()["remaining"].(int) - 1
+				visits = append(visits, fmt.Sprintf("inner%d/%v",
+					exchange.Properties()[LoopIndexProperty], exchange.Properties()[LoopSizeProperty]))
+			}).
+			End().
+			ProcessFunction(func(exchange Exchange) {
+				visits = append(visits, fmt.Sprintf("outer%d/%v",
+					exchange.Properties()[LoopIndexProperty], exchange.Properties()[LoopSizeProperty]))
+			}).
+			End()
+	})
+	context.Start()
+
+	// the while loop has no size of its own so the outer one is hidden
+	// until it ends
+	component.send("test:start", NewTextMessage("hello"))
+	assert.Equal(t, []string{
+		"inner0/<nil>", "inner1/<nil>", "outer0/2",
+		"inner0/<nil>", "inner1/<nil>", "outer1/2",
+	}, visits)
+}
+
+func TestLoopWhileLimit(t *testing.T) {
+	context, component := newTestContext()
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:default").
+			LoopWhile(func(exchange Exchange) bool { return true }).
+			ToS("test:forever").
+			End()
+		builder.FromS("test:limited").
+			LoopWhileWith(func(exchange Exchange) bool { return true }, LoopOptions{MaxIterations: 3}).
+			ToS("test:limit").
+			End()
+	})
+	context.Start()
+
+	exchange := component.send("test:default", NewTextMessage("hello"))
+	assert.Equal(t, LoopLimitExceeded{Iterations: DefaultLoopMaxIterations}, exchange.Error())
+	assert.Equal(t, DefaultLoopMaxIterations, component.count("test:forever"))
+
+	exchange = component.send("test:limited", NewTextMessage("hello"))
+	assert.Equal(t, LoopLimitExceeded{Iterations: 3}, exchange.Error())
+	assert.Equal(t, 3, component.count("test:limit"))
+}
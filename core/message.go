@@ -18,6 +18,24 @@ type Message interface {
 	Headers() *map[string]interface{}
 }
 
+// A CopyableMessage is a Message that can create a copy of itself that
+// can be changed without affecting the original. Messages are copied
+// when the same exchange is sent to more than one place.
+type CopyableMessage interface {
+	Message
+
+	Copy() Message
+}
+
+// CopyMessage returns a copy of the message if it is a CopyableMessage
+// or the message itself if it is not.
+func CopyMessage(message Message) Message {
+	if copyable, ok := message.(CopyableMessage); ok {
+		return copyable.Copy()
+	}
+	return message
+}
+
 type coreMessage struct {
 	headers *map[string]interface{}
 	body    interface{}
@@ -31,6 +49,42 @@ func newCoreMessage(body interface{}) coreMessage {
 	}
 }
 
+// NewMessage creates a Message with the body and no headers. A string body
+// creates a TextMessage.
+func NewMessage(body interface{}) Message {
+	if text, ok := body.(string); ok {
+		return NewTextMessage(text)
+	}
+	return newCoreMessage(body)
+}
+
+// withBody creates a Message with the body and a copy of the headers of the
+// message
+func withBody(message Message, body interface{}) Message {
+	replaced := NewMessage(body)
+	if message != nil && message.Headers() != nil {
+		for key, value := range *message.Headers() {
+			(*replaced.Headers())[key] = value
+		}
+	}
+	return replaced
+}
+
+func (c coreMessage) Copy() Message {
+	return c.copy()
+}
+
+func (c coreMessage) copy() coreMessage {
+	headers := make(map[string]interface{}, len(*c.headers))
+	for key, value := range *c.headers {
+		headers[key] = value
+	}
+	return coreMessage{
+		headers: &headers,
+		body:    c.body,
+	}
+}
+
 func (c coreMessage) Headers() *map[string]interface{} {
 	return c.headers
 }
@@ -56,3 +110,9 @@ type TextMessage struct {
 func (t TextMessage) Text() string {
 	return fmt.Sprintf("%v", t.body)
 }
+
+func (t TextMessage) Copy() Message {
+	return TextMessage{
+		coreMessage: t.coreMessage.copy(),
+	}
+}
@@ -0,0 +1,200 @@
+package core
+
+import (
+	"time"
+)
+
+// MulticastOptions configure how a Multicast sends the exchange to each
+// of its endpoints and how the replies are combined.
+type MulticastOptions struct {
+	// Parallel sends to every endpoint at the same time instead of one
+	// after the other.
+	Parallel bool
+
+	// Workers is the most sends that a parallel Multicast runs at once
+	// across every exchange passing through it. Zero means there is no
+	// limit.
+	Workers int
+
+	// Timeout is how long a parallel Multicast waits for the endpoints.
+	// Replies that arrive after the timeout are not aggregated. Zero
+	// means there is no timeout.
+	Timeout time.Duration
+
+	// StopOnError fails the exchange as soon as an endpoint fails and
+	// does not send to the endpoints that have not been sent to yet.
+	StopOnError bool
+
+	// Strategy combines the replies of the endpoints into the out message
+	// of the exchange. Failed replies are aggregated like any other so
+	// that the strategy decides whether they fail the exchange. When it is
+	// not set UseLatest is used and the exchange fails with the error of
+	// the first endpoint that failed, in the order of the endpoints.
+	Strategy AggregationStrategy
+}
+
+// multicast sends an independent copy of the exchange to each producer and
+// aggregates the results into the out message of the original exchange.
+type multicast struct {
+	options   MulticastOptions
+	producers []Producer
+	workers   chan struct{}
+
+	// failFirst fails the exchange with the first error of the endpoints
+	// when there is no strategy to decide what to do with the errors
+	failFirst bool
+}
+
+func newMulticast(options MulticastOptions, producers []Producer) *multicast {
+	failFirst := options.Strategy == nil
+	if options.Strategy == nil {
+		options.Strategy = UseLatest
+	}
+	m := &multicast{
+		options:   options,
+		producers: producers,
+		failFirst: failFirst,
+	}
+	if options.Workers > 0 {
+		m.workers = make(chan struct{}, options.Workers)
+	}
+	return m
+}
+
+func (m *multicast) Process(exchange Exchange) {
+	m.process(exchange, m.producers)
+}
+
+// process the exchange with the given producers which are not always the
+// producers of the multicast when it is used by another step
+func (m *multicast) process(exchange Exchange, producers []Producer) {
+	var results []Exchange
+	if m.options.Parallel {
+		results = m.parallel(exchange, producers)
+	} else {
+		results = m.sequential(exchange, producers)
+	}
+
+	var aggregated Exchange
+	var failed error
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		if m.options.StopOnError && result.Error() != nil {
+			exchange.SetError(result.Error())
+			return
+		}
+		failed = firstError(failed, result.Error())
+		aggregated = m.options.Strategy.Aggregate(aggregated, result)
+	}
+	if m.failFirst && failed != nil {
+		exchange.SetError(failed)
+		return
+	}
+	if aggregated == nil {
+		return
+	}
+	if aggregated.Error() != nil {
+		exchange.SetError(aggregated.Error())
+		return
+	}
+	exchange.Out(aggregated.In())
+}
+
+func (m *multicast) sequential(exchange Exchange, producers []Producer) []Exchange {
+	results := make([]Exchange, len(producers))
+	for idx, producer := range producers {
+		results[idx] = m.send(producer, newCopiedExchange(exchange))
+		if m.options.StopOnError && results[idx].Error() != nil {
+			break
+		}
+	}
+	return results
+}
+
+// parallel sends to each producer on its own goroutine and collects the
+// results until they have all arrived, one fails and StopOnError is set,
+// or the timeout expires. Sends that have not acquired a worker by then
+// are abandoned.
+func (m *multicast) parallel(exchange Exchange, producers []Producer) []Exchange {
+	type indexed struct {
+		idx    int
+		result Exchange
+	}
+
+	// the copies are created up front so that the goroutines never
+	// touch the original exchange
+	copies := make([]Exchange, len(producers))
+	for idx := range producers {
+		copies[idx] = newCopiedExchange(exchange)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	arrived := make(chan indexed, len(producers))
+	for idx, producer := range producers {
+		go func(idx int, producer Producer) {
+			if m.workers != nil {
+				select {
+				case m.workers <- struct{}{}:
+					defer func() { <-m.workers }()
+				case <-done:
+					return
+				}
+			}
+			arrived <- indexed{idx: idx, result: m.send(producer, copies[idx])}
+		}(idx, producer)
+	}
+
+	var timeout <-chan time.Time
+	if m.options.Timeout > 0 {
+		timer := time.NewTimer(m.options.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	results := make([]Exchange, len(producers))
+	for remaining := len(producers); remaining > 0; remaining-- {
+		select {
+		case a := <-arrived:
+			results[a.idx] = a.result
+			if m.options.StopOnError && a.result.Error() != nil {
+				return results
+			}
+		case <-timeout:
+			return results
+		}
+	}
+	return results
+}
+
+func (m *multicast) send(producer Producer, exchange Exchange) Exchange {
+	producer.Process(exchange)
+	exchange.rotate()
+	return exchange
+}
+
+func (m *multicast) Init() {
+	for _, producer := range m.producers {
+		producer.Init()
+	}
+}
+
+func (m *multicast) Start() {
+	for _, producer := range m.producers {
+		producer.Start()
+	}
+}
+
+func (m *multicast) Stop() {
+	for _, producer := range m.producers {
+		producer.Stop()
+	}
+}
+
+func (m *multicast) Close() {
+	for _, producer := range m.producers {
+		producer.Close()
+	}
+}
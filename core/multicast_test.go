@@ -0,0 +1,166 @@
+package core
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// joins the bodies of every reply in the order they are aggregated
+var joinBodies = AggregationFunction(func(oldExchange Exchange, newExchange Exchange) Exchange {
+	if oldExchange == nil {
+		return newExchange
+	}
+	body := oldExchange.In().Body().(string) + "," + newExchange.In().Body().(string)
+	oldExchange.Out(NewTextMessage(body))
+	oldExchange.rotate()
+	return oldExchange
+})
+
+func replyWith(body string, delay time.Duration) ProcessingFunction {
+	return func(exchange Exchange) {
+		time.Sleep(delay)
+		(*exchange.In().Headers())["changed"] = true
+		exchange.Out(NewTextMessage(body))
+	}
+}
+
+func TestMulticastSequential(t *testing.T) {
+	context, component := newTestContext()
+	component.handle("test:a", replyWith("a", 0))
+	component.handle("test:b", replyWith("b", 0))
+
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").RequestReply().
+			MulticastWith(MulticastOptions{Strategy: joinBodies}, "test:a", "test:b")
+	})
+	context.Start()
+
+	message := NewTextMessage("hello")
+	exchange := component.send("test:start", message)
+	assert.Equal(t, "a,b", exchange.In().Body())
+
+	// every endpoint gets its own copy of the message
+	_, changed := (*message.Headers())["changed"]
+	assert.False(t, changed)
+}
+
+func TestMulticastParallel(t *testing.T) {
+	context, component := newTestContext()
+	component.handle("test:slow", replyWith("slow", 20*time.Millisecond))
+	component.handle("test:fast", replyWith("fast", 0))
+	component.handle("test:stuck", replyWith("stuck", time.Second))
+
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:parallel").RequestReply().
+			MulticastWith(MulticastOptions{Parallel: true, Strategy: joinBodies}, "test:slow", "test:fast")
+		builder.FromS("test:timeout").RequestReply().
+			MulticastWith(MulticastOptions{Parallel: true, Timeout: 50 * time.Millisecond, Strategy: joinBodies}, "test:fast", "test:stuck")
+	})
+	context.Start()
+
+	// results are aggregated in endpoint order regardless of arrival
+	exchange := component.send("test:parallel", NewTextMessage("hello"))
+	assert.Equal(t, "slow,fast", exchange.In().Body())
+
+	start := time.Now()
+	exchange = component.send("test:timeout", NewTextMessage("hello"))
+	assert.Equal(t, "fast", exchange.In().Body())
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestMulticastWorkers(t *testing.T) {
+	context, component := newTestContext()
+
+	var running, most int32
+	limited := func(exchange Exchange) {
+		now := atomic.AddInt32(&running, 1)
+		for {
+			seen := atomic.LoadInt32(&most)
+			if now <= seen || atomic.CompareAndSwapInt32(&most, seen, now) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+	}
+	endpoints := []string{"test:1", "test:2", "test:3", "test:4", "test:5"}
+	for _, endpoint := range endpoints {
+		component.handle(endpoint, limited)
+	}
+
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").
+			MulticastWith(MulticastOptions{Parallel: true, Workers: 2}, endpoints...)
+	})
+	context.Start()
+
+	component.send("test:start", NewTextMessage("hello"))
+	assert.True(t, atomic.LoadInt32(&most) <= 2)
+	for _, endpoint := range endpoints {
+		assert.Equal(t, 1, component.count(endpoint))
+	}
+}
+
+func TestMulticastStopOnError(t *testing.T) {
+	context, component := newTestContext()
+	failure := errors.New("failed")
+	component.handle("test:fail", func(exchange Exchange) {
+		exchange.SetError(failure)
+	})
+
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:stop").
+			MulticastWith(MulticastOptions{StopOnError: true}, "test:a", "test:fail", "test:b").
+			ToS("test:after")
+		builder.FromS("test:continue").
+			MulticastWith(MulticastOptions{Strategy: joinBodies}, "test:fail", "test:c").
+			ToS("test:after")
+	})
+	context.Start()
+
+	exchange := component.send("test:stop", NewTextMessage("hello"))
+	assert.Equal(t, failure, exchange.Error())
+	assert.Equal(t, 1, component.count("test:a"))
+	assert.Equal(t, 0, component.count("test:b"))
+	assert.Equal(t, 0, component.count("test:after"))
+
+	exchange = component.send("test:continue", NewTextMessage("hello"))
+	assert.Equal(t, failure, exchange.Error())
+	assert.Equal(t, 1, component.count("test:c"))
+}
+
+func TestMulticastDefaultStrategyError(t *testing.T) {
+	context, component := newTestContext()
+	first := errors.New("first")
+	second := errors.New("second")
+	component.handle("test:first", func(exchange Exchange) {
+		exchange.SetError(first)
+	})
+	component.handle("test:second", func(exchange Exchange) {
+		exchange.SetError(second)
+	})
+
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:sequential").
+			Multicast("test:a", "test:first", "test:second", "test:b").
+			ToS("test:after")
+		builder.FromS("test:parallel").
+			MulticastWith(MulticastOptions{Parallel: true}, "test:a", "test:first", "test:second", "test:b").
+			ToS("test:after")
+	})
+	context.Start()
+
+	// the error of the first endpoint to fail is kept even though the
+	// endpoints after it succeeded
+	for _, start := range []string{"test:sequential", "test:parallel"} {
+		exchange := component.send(start, NewTextMessage("hello"))
+		assert.Equal(t, first, exchange.Error())
+	}
+	assert.Equal(t, 2, component.count("test:a"))
+	assert.Equal(t, 2, component.count("test:b"))
+	assert.Equal(t, 0, component.count("test:after"))
+}
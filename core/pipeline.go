@@ -0,0 +1,53 @@
+package core
+
+// pipeline is an ordered list of processors. Each step gets the
+// exchange in turn and the out message of a step is rotated to
+// become the in message of the next step. The pipeline stops at
+// the first step that sets an error on the exchange. Steps are stopped
+// and closed in the reverse order they were started.
+type pipeline []Processor
+
+func (p pipeline) Process(exchange Exchange) {
+	for idx := 0; idx < len(p); idx++ {
+		if p[idx] == nil {
+			continue
+		}
+		p[idx].Process(exchange)
+		exchange.rotate()
+		if exchange.Error() != nil {
+			return
+		}
+	}
+}
+
+func (p pipeline) Init() {
+	for _, s := range p {
+		if c, ok := s.(Producer); ok {
+			c.Init()
+		}
+	}
+}
+
+func (p pipeline) Start() {
+	for _, s := range p {
+		if c, ok := s.(Producer); ok {
+			c.Start()
+		}
+	}
+}
+
+func (p pipeline) Stop() {
+	for idx := len(p) - 1; idx >= 0; idx-- {
+		if c, ok := p[idx].(Producer); ok {
+			c.Stop()
+		}
+	}
+}
+
+func (p pipeline) Close() {
+	for idx := len(p) - 1; idx >= 0; idx-- {
+		if c, ok := p[idx].(Producer); ok {
+			c.Close()
+		}
+	}
+}
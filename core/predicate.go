@@ -0,0 +1,25 @@
+package core
+
+// A Predicate is evaluated against an Exchange to decide how it
+// should be routed.
+type Predicate func(exchange Exchange) bool
+
+// HeaderEquals returns a Predicate that matches exchanges whose in
+// message has the header set to the value.
+func HeaderEquals(header string, value interface{}) Predicate {
+	return func(exchange Exchange) bool {
+		in := exchange.In()
+		if in == nil || in.Headers() == nil {
+			return false
+		}
+		found, ok := (*in.Headers())[header]
+		return ok && found == value
+	}
+}
+
+// Not returns a Predicate that matches when the given Predicate does not.
+func Not(predicate Predicate) Predicate {
+	return func(exchange Exchange) bool {
+		return !predicate(exchange)
+	}
+}
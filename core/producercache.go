@@ -0,0 +1,79 @@
+package core
+
+import "sync"
+
+// producerCache creates Producers for endpoint strings that are only known
+// at runtime and keeps them so that each endpoint only has one Producer.
+// The Producers follow the lifecycle of the step that owns the cache so
+// a Producer created after the route has started is started right away.
+type producerCache struct {
+	lock       sync.Mutex
+	components componentLookup
+	producers  map[string]Producer
+	order      []string
+	started    bool
+	routeId    *string
+	events     *eventNotifiers
+}
+
+func newProducerCache(components componentLookup) *producerCache {
+	return &producerCache{
+		components: components,
+		producers:  make(map[string]Producer),
+	}
+}
+
+func (p *producerCache) get(endpoint string) (Producer, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if producer, found := p.producers[endpoint]; found {
+		return producer, nil
+	}
+	resolved, err := resolveEndpoint(p.components, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	producer, err := resolved.CreateProducer()
+	if err != nil {
+		return nil, err
+	}
+	producer = newSendingProducer(producer, endpoint, p.routeId, p.events)
+	producer.Init()
+	if p.started {
+		producer.Start()
+	}
+	p.producers[endpoint] = producer
+	p.order = append(p.order, endpoint)
+	return producer, nil
+}
+
+func (p *producerCache) Init() {
+}
+
+func (p *producerCache) Start() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.started = true
+	for _, endpoint := range p.order {
+		p.producers[endpoint].Start()
+	}
+}
+
+func (p *producerCache) Stop() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.started = false
+	for idx := len(p.order) - 1; idx >= 0; idx-- {
+		p.producers[p.order[idx]].Stop()
+	}
+}
+
+func (p *producerCache) Close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for idx := len(p.order) - 1; idx >= 0; idx-- {
+		p.producers[p.order[idx]].Close()
+	}
+	p.producers = make(map[string]Producer)
+	p.order = nil
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A RouterFunction returns the next endpoint for a DynamicRouter to send
+// the exchange to or an empty string when the exchange has arrived.
+type RouterFunction func(exchange Exchange) string
+
+// endpointList converts the value of an expression into endpoint strings.
+// The value can be a comma separated string or a slice of strings or of
+// values that are formatted as strings.
+func endpointList(value interface{}) []string {
+	endpoints := make([]string, 0)
+	switch v := value.(type) {
+	case nil:
+	case string:
+		for _, endpoint := range strings.Split(v, ",") {
+			if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+				endpoints = append(endpoints, endpoint)
+			}
+		}
+	case []string:
+		endpoints = append(endpoints, v...)
+	case []interface{}:
+		for _, endpoint := range v {
+			endpoints = append(endpoints, fmt.Sprint(endpoint))
+		}
+	default:
+		endpoints = append(endpoints, fmt.Sprint(v))
+	}
+	return endpoints
+}
+
+// recipientList multicasts the exchange to the endpoints that the
+// expression evaluates to for each exchange.
+type recipientList struct {
+	expression Expression
+	multicast  *multicast
+	cache      *producerCache
+}
+
+func (r *recipientList) Process(exchange Exchange) {
+	endpoints := endpointList(r.expression(exchange))
+	producers := make([]Producer, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		producer, err := r.cache.get(endpoint)
+		if err != nil {
+			exchange.SetError(err)
+			return
+		}
+		producers = append(producers, producer)
+	}
+	r.multicast.process(exchange, producers)
+}
+
+func (r *recipientList) Init() {
+	r.cache.Init()
+}
+
+func (r *recipientList) Start() {
+	r.cache.Start()
+}
+
+func (r *recipientList) Stop() {
+	r.cache.Stop()
+}
+
+func (r *recipientList) Close() {
+	r.cache.Close()
+}
+
+// dynamicRouter sends the exchange to the endpoint returned by the router
+// function, rotating the out message to the in message after each step,
+// until the function returns an empty string.
+type dynamicRouter struct {
+	router RouterFunction
+	cache  *producerCache
+}
+
+func (d *dynamicRouter) Process(exchange Exchange) {
+	for endpoint := d.router(exchange); endpoint != ""; endpoint = d.router(exchange) {
+		producer, err := d.cache.get(endpoint)
+		if err != nil {
+			exchange.SetError(err)
+			return
+		}
+		producer.Process(exchange)
+		exchange.rotate()
+		if exchange.Error() != nil {
+			return
+		}
+	}
+}
+
+func (d *dynamicRouter) Init() {
+	d.cache.Init()
+}
+
+func (d *dynamicRouter) Start() {
+	d.cache.Start()
+}
+
+func (d *dynamicRouter) Stop() {
+	d.cache.Stop()
+}
+
+func (d *dynamicRouter) Close() {
+	d.cache.Close()
+}
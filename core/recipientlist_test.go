@@ -0,0 +1,87 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecipientList(t *testing.T) {
+	context, component := newTestContext()
+
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").RecipientList(Header("recipients")).ToS("test:after")
+	})
+	context.Init()
+	context.Start()
+
+	message := NewTextMessage("hello")
+	(*message.Headers())["recipients"] = "test:a, test:b"
+	component.send("test:start", message)
+
+	message = NewTextMessage("hello")
+	(*message.Headers())["recipients"] = []string{"test:b", "test:c"}
+	component.send("test:start", message)
+
+	assert.Equal(t, 1, component.count("test:a"))
+	assert.Equal(t, 2, component.count("test:b"))
+	assert.Equal(t, 1, component.count("test:c"))
+	assert.Equal(t, 2, component.count("test:after"))
+	assert.Equal(t, "started", component.state("test:c"))
+
+	message = NewTextMessage("hello")
+	(*message.Headers())["recipients"] = "unknown:a"
+	exchange := component.send("test:start", message)
+	assert.IsType(t, UnknownEndpoint{}, exchange.Error())
+
+	context.Stop()
+	assert.Equal(t, "stopped", component.state("test:a"))
+	assert.Equal(t, "stopped", component.state("test:c"))
+}
+
+func TestDynamicRouter(t *testing.T) {
+	context, component := newTestContext()
+	component.handle("test:upper", func(exchange Exchange) {
+		exchange.Out(NewTextMessage(strings.ToUpper(exchange.In().Body().(string))))
+	})
+
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").RequestReply().DynamicRouter(func(exchange Exchange) string {
+			visits, _ := exchange.Properties()["visits"].(int)
+			exchange.Properties()["visits"] = visits + 1
+			switch visits {
+			case 0:
+				return "test:upper"
+			case 1:
+				return "test:audit"
+			}
+			return ""
+		})
+	})
+	context.Start()
+
+	exchange := component.send("test:start", NewTextMessage("hello"))
+	assert.Equal(t, "HELLO", exchange.In().Body())
+	assert.Equal(t, 3, exchange.Properties()["visits"])
+	assert.Equal(t, 1, component.count("test:audit"))
+	assert.Equal(t, "HELLO", component.received["test:audit"][0].Body())
+}
+
+func TestRecipientListLateComponent(t *testing.T) {
+	context, component := newTestContext()
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").RecipientList(Header("recipients"))
+	})
+	context.Start()
+
+	// the component is registered after the route was added
+	late := registerTestComponent(context, "late")
+
+	message := NewTextMessage("hello")
+	(*message.Headers())["recipients"] = "late:a"
+	exchange := component.send("test:start", message)
+	assert.Nil(t, exchange.Error())
+	assert.Equal(t, 1, late.count("late:a"))
+	assert.Equal(t, "started", late.state("late:a"))
+}
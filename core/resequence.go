@@ -0,0 +1,337 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ResequenceMode selects the algorithm used by a Resequence block.
+type ResequenceMode int
+
+const (
+	// BatchResequence collects exchanges until the batch is full or the
+	// batch timeout expires and then sends the batch on in order.
+	BatchResequence ResequenceMode = iota
+
+	// StreamResequence sends each exchange on as soon as every exchange
+	// with a lower sequence number has been sent. A gap in the sequence
+	// is skipped once it has been waited on for the timeout or when the
+	// number of waiting exchanges is more than the capacity.
+	StreamResequence
+)
+
+const (
+	// DefaultResequenceSize is the batch size or the stream capacity used
+	// when ResequenceOptions does not set one.
+	DefaultResequenceSize = 100
+
+	// DefaultResequenceTimeout is the batch or gap timeout used when
+	// ResequenceOptions does not set one.
+	DefaultResequenceTimeout = time.Second
+)
+
+// ResequenceOptions configure a Resequence block.
+type ResequenceOptions struct {
+	Mode ResequenceMode
+
+	// Size is the largest batch in BatchResequence mode and the most
+	// exchanges that can wait for a gap in StreamResequence mode.
+	Size int
+
+	// Timeout is how long the first exchange of a batch waits for the
+	// batch to fill in BatchResequence mode and how long a gap is waited
+	// on in StreamResequence mode.
+	Timeout time.Duration
+}
+
+// InvalidSequence is the error set on an exchange when the sequence
+// expression of a Resequence block does not evaluate to an integer.
+type InvalidSequence struct {
+	Value interface{}
+}
+
+func (i InvalidSequence) Error() string {
+	return fmt.Sprintf("The sequence value %v is not an integer", i.Value)
+}
+
+// OutOfSequence is the error set on an exchange that arrives at a stream
+// Resequence block after exchanges with a higher sequence number have
+// already been sent on.
+type OutOfSequence struct {
+	Sequence int64
+}
+
+func (o OutOfSequence) Error() string {
+	return fmt.Sprintf("The sequence number %d arrived after it was skipped", o.Sequence)
+}
+
+// sequenceNumber converts the value of a sequence expression to an integer
+func sequenceNumber(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return int64(v), nil
+	case string:
+		if number, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return number, nil
+		}
+	}
+	return 0, InvalidSequence{Value: value}
+}
+
+// an exchange waiting in a resequencer along with the goroutine that is
+// blocked until it has been through the block
+type sequenced struct {
+	exchange Exchange
+	sequence int64
+	arrived  time.Time
+	err      error
+	done     chan struct{}
+}
+
+// resequencer is the block opened by RouteConfiguration.Resequence. The
+// goroutine calling Process waits while the exchange is reordered and the
+// steps of the block are run for each exchange, in order, by a single
+// delivery goroutine.
+type resequencer struct {
+	expression Expression
+	options    ResequenceOptions
+	processors pipeline
+
+	lock    sync.Mutex
+	buffer  []*sequenced
+	next    int64
+	hasNext bool
+	running bool
+	wake    chan struct{}
+	stop    chan struct{}
+	stopped sync.WaitGroup
+	now     func() time.Time
+}
+
+// resequencerCreated is called with every new resequencer so that tests
+// can replace its clock and watch what it is holding
+var resequencerCreated = func(r *resequencer) {}
+
+func newResequencer(expression Expression, options ResequenceOptions) *resequencer {
+	if options.Size <= 0 {
+		options.Size = DefaultResequenceSize
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultResequenceTimeout
+	}
+	r := &resequencer{
+		expression: expression,
+		options:    options,
+		processors: make(pipeline, 0),
+		wake:       make(chan struct{}, 1),
+		now:        time.Now,
+	}
+	resequencerCreated(r)
+	return r
+}
+
+func (r *resequencer) add(processor Processor) {
+	r.processors = append(r.processors, processor)
+}
+
+func (r *resequencer) Process(exchange Exchange) {
+	sequence, err := sequenceNumber(r.expression(exchange))
+	if err != nil {
+		exchange.SetError(err)
+		return
+	}
+
+	r.lock.Lock()
+	if !r.running {
+		// without the delivery goroutine there is nothing to wait for
+		r.lock.Unlock()
+		r.processors.Process(exchange)
+		return
+	}
+	if r.options.Mode == StreamResequence && r.hasNext && sequence < r.next {
+		r.lock.Unlock()
+		exchange.SetError(OutOfSequence{Sequence: sequence})
+		return
+	}
+	waiting := &sequenced{
+		exchange: exchange,
+		sequence: sequence,
+		arrived:  r.now(),
+		done:     make(chan struct{}),
+	}
+	r.buffer = append(r.buffer, waiting)
+	r.lock.Unlock()
+
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+	<-waiting.done
+}
+
+// deliver runs the steps of the block for the exchange and releases the
+// goroutine waiting on it
+func (r *resequencer) deliver(waiting *sequenced) {
+	if waiting.err != nil {
+		waiting.exchange.SetError(waiting.err)
+	} else {
+		r.processors.Process(waiting.exchange)
+	}
+	close(waiting.done)
+}
+
+func (r *resequencer) run(stop chan struct{}) {
+	defer r.stopped.Done()
+	for {
+		r.lock.Lock()
+		var ready []*sequenced
+		var wait time.Duration
+		if r.options.Mode == StreamResequence {
+			ready, wait = r.takeStream(r.now())
+		} else {
+			ready, wait = r.takeBatch(r.now())
+		}
+		r.lock.Unlock()
+
+		for _, waiting := range ready {
+			r.deliver(waiting)
+		}
+		if len(ready) > 0 {
+			continue
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-r.wake:
+		case <-timeout:
+		case <-stop:
+			r.flush()
+			return
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// takeBatch returns the next batch sorted by sequence number once it is
+// full or its first exchange has waited for the timeout. Otherwise it
+// returns how long to wait for the timeout. The lock must be held.
+func (r *resequencer) takeBatch(now time.Time) ([]*sequenced, time.Duration) {
+	if len(r.buffer) == 0 {
+		return nil, 0
+	}
+	elapsed := now.Sub(r.buffer[0].arrived)
+	if len(r.buffer) < r.options.Size && elapsed < r.options.Timeout {
+		return nil, r.options.Timeout - elapsed
+	}
+	size := len(r.buffer)
+	if size > r.options.Size {
+		size = r.options.Size
+	}
+	batch := append([]*sequenced(nil), r.buffer[:size]...)
+	r.buffer = r.buffer[size:]
+	sort.SliceStable(batch, func(i, j int) bool {
+		return batch[i].sequence < batch[j].sequence
+	})
+	return batch, 0
+}
+
+// takeStream returns the exchanges that can be sent on in order, skipping
+// the gap in front of the lowest waiting sequence number when it has waited
+// for the timeout or the capacity is exceeded. Otherwise it returns how long
+// to wait for the gap to time out. The lock must be held.
+func (r *resequencer) takeStream(now time.Time) ([]*sequenced, time.Duration) {
+	sort.SliceStable(r.buffer, func(i, j int) bool {
+		return r.buffer[i].sequence < r.buffer[j].sequence
+	})
+
+	ready := make([]*sequenced, 0)
+	for len(r.buffer) > 0 {
+		head := r.buffer[0]
+		switch {
+		case r.hasNext && head.sequence < r.next:
+			// a duplicate of a sequence number that was already sent
+			head.err = OutOfSequence{Sequence: head.sequence}
+		case r.hasNext && head.sequence == r.next,
+			len(r.buffer) > r.options.Size,
+			now.Sub(head.arrived) >= r.options.Timeout:
+			r.next = head.sequence + 1
+			r.hasNext = true
+		default:
+			return ready, r.options.Timeout - now.Sub(head.arrived)
+		}
+		ready = append(ready, head)
+		r.buffer = r.buffer[1:]
+	}
+	return ready, 0
+}
+
+// flush sends every waiting exchange on in order when the block is stopped
+func (r *resequencer) flush() {
+	r.lock.Lock()
+	waiting := r.buffer
+	r.buffer = nil
+	r.lock.Unlock()
+
+	sort.SliceStable(waiting, func(i, j int) bool {
+		return waiting[i].sequence < waiting[j].sequence
+	})
+	for _, w := range waiting {
+		r.deliver(w)
+	}
+}
+
+func (r *resequencer) Init() {
+	r.processors.Init()
+}
+
+func (r *resequencer) Start() {
+	r.processors.Start()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.running {
+		return
+	}
+	r.running = true
+	r.stop = make(chan struct{})
+	r.stopped.Add(1)
+	go r.run(r.stop)
+}
+
+// Stop sends every waiting exchange on before stopping the steps of the
+// block.
+func (r *resequencer) Stop() {
+	r.lock.Lock()
+	if r.running {
+		r.running = false
+		close(r.stop)
+	}
+	r.lock.Unlock()
+
+	r.stopped.Wait()
+	r.processors.Stop()
+}
+
+func (r *resequencer) Close() {
+	r.processors.Close()
+}
@@ -0,0 +1,194 @@
+package core
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// a clock that only moves when the test moves it
+type testClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(duration time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(duration)
+}
+
+// the sequence numbers in the order they came out of the resequencer
+type sequenceRecorder struct {
+	lock  sync.Mutex
+	order []interface{}
+}
+
+func (s *sequenceRecorder) record(exchange Exchange) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.order = append(s.order, (*exchange.In().Headers())["seq"])
+}
+
+func (s *sequenceRecorder) take() []interface{} {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	order := s.order
+	s.order = make([]interface{}, 0)
+	return order
+}
+
+func (s *sequenceRecorder) count() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.order)
+}
+
+// send the sequence numbers at the same time and return a function that
+// waits for them all
+func sendSequences(component *testComponent, path string, sequences ...int) func() []Exchange {
+	exchanges := make([]Exchange, len(sequences))
+	wg := sync.WaitGroup{}
+	for idx, sequence := range sequences {
+		wg.Add(1)
+		go func(idx int, sequence int) {
+			defer wg.Done()
+			message := NewTextMessage("event")
+			(*message.Headers())["seq"] = sequence
+			exchanges[idx] = component.send(path, message)
+		}(idx, sequence)
+	}
+	return func() []Exchange {
+		wg.Wait()
+		return exchanges
+	}
+}
+
+// newResequenceTest starts a route with a resequencer on a clock that the
+// test moves
+func newResequenceTest(options ResequenceOptions) (Context, *testComponent, *resequencer, *testClock, *sequenceRecorder) {
+	context, component := newTestContext()
+	clock := &testClock{now: time.Now()}
+	recorder := &sequenceRecorder{order: make([]interface{}, 0)}
+	var block *resequencer
+	resequencerCreated = func(r *resequencer) {
+		block = r
+		r.now = clock.Now
+	}
+	defer func() {
+		resequencerCreated = func(r *resequencer) {}
+	}()
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").ResequenceWith(Header("seq"), options).
+			ProcessFunction(recorder.record).
+			End()
+	})
+	context.Start()
+	return context, component, block, clock, recorder
+}
+
+// waitFor blocks until the number of exchanges are waiting in the
+// resequencer and the number have come out of it
+func waitFor(t *testing.T, r *resequencer, recorder *sequenceRecorder, waiting int, delivered int) {
+	assert.Eventually(t, func() bool {
+		r.lock.Lock()
+		buffered := len(r.buffer)
+		r.lock.Unlock()
+		return buffered == waiting && recorder.count() == delivered
+	}, 5*time.Second, time.Millisecond)
+}
+
+// expire moves the clock past the timeout and wakes the resequencer
+func expire(r *resequencer, clock *testClock) {
+	clock.Advance(r.options.Timeout)
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func TestBatchResequence(t *testing.T) {
+	context, component, _, _, recorder := newResequenceTest(ResequenceOptions{Size: 5, Timeout: time.Minute})
+	defer context.Stop()
+
+	// the full batch is sent on without waiting for the timeout
+	sendSequences(component, "test:start", 4, 2, 5, 1, 3)()
+	assert.Equal(t, []interface{}{1, 2, 3, 4, 5}, recorder.take())
+}
+
+func TestBatchResequenceTimeout(t *testing.T) {
+	context, component, block, clock, recorder := newResequenceTest(ResequenceOptions{Size: 10, Timeout: time.Minute})
+	defer context.Stop()
+
+	// a partial batch is only released by the timeout
+	wait := sendSequences(component, "test:start", 3, 1, 2)
+	waitFor(t, block, recorder, 3, 0)
+	expire(block, clock)
+	for _, exchange := range wait() {
+		assert.Nil(t, exchange.Error())
+	}
+	assert.Equal(t, []interface{}{1, 2, 3}, recorder.take())
+}
+
+func TestStreamResequence(t *testing.T) {
+	context, component, block, clock, recorder := newResequenceTest(ResequenceOptions{Mode: StreamResequence, Size: 10, Timeout: time.Minute})
+	defer context.Stop()
+
+	// the first exchanges wait for the gap timeout because nothing has
+	// been seen before them
+	wait := sendSequences(component, "test:start", 3, 1, 2)
+	waitFor(t, block, recorder, 3, 0)
+	expire(block, clock)
+	wait()
+	assert.Equal(t, []interface{}{1, 2, 3}, recorder.take())
+
+	// 4 is next so it is sent on straight away while 6 and 7 wait for the
+	// missing 5 until the gap times out
+	wait = sendSequences(component, "test:start", 7, 4, 6)
+	waitFor(t, block, recorder, 2, 1)
+	expire(block, clock)
+	wait()
+	assert.Equal(t, []interface{}{4, 6, 7}, recorder.take())
+
+	// sequence numbers that were skipped are rejected
+	exchanges := sendSequences(component, "test:start", 5)()
+	assert.Equal(t, OutOfSequence{Sequence: 5}, exchanges[0].Error())
+
+	message := NewTextMessage("event")
+	(*message.Headers())["seq"] = "not a number"
+	exchange := component.send("test:start", message)
+	assert.Equal(t, InvalidSequence{Value: "not a number"}, exchange.Error())
+	assert.Equal(t, 0, recorder.count())
+}
+
+func TestStreamResequenceCapacity(t *testing.T) {
+	context, component, block, clock, recorder := newResequenceTest(ResequenceOptions{Mode: StreamResequence, Size: 3, Timeout: time.Minute})
+	defer context.Stop()
+
+	wait := sendSequences(component, "test:start", 1)
+	waitFor(t, block, recorder, 1, 0)
+	expire(block, clock)
+	wait()
+	assert.Equal(t, []interface{}{1}, recorder.take())
+
+	// the block holds as many exchanges as its size while it waits for
+	// the missing 2 and 3
+	wait = sendSequences(component, "test:start", 5, 4, 6)
+	waitFor(t, block, recorder, 3, 0)
+
+	// one more skips the gap without waiting for the timeout
+	sendSequences(component, "test:start", 7)()
+	wait()
+	assert.Equal(t, []interface{}{4, 5, 6, 7}, recorder.take())
+
+	exchanges := sendSequences(component, "test:start", 2)()
+	assert.Equal(t, OutOfSequence{Sequence: 2}, exchanges[0].Error())
+}
@@ -1,8 +1,11 @@
 package core
 
 import (
+	gocontext "context"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 )
 
 type RouteCreator func(builder RouteBuilder)
@@ -14,16 +17,20 @@ type RouteBuilder interface {
 }
 
 type routeBuilder struct {
-	components          map[string]Component
+	components          componentLookup
+	events              *eventNotifiers
 	routeConfigurations []*routeConfiguration
 }
 
 func (r *routeBuilder) From(endpoint Endpoint) RouteConfiguration {
 	routeConfiguration := &routeConfiguration{
 		components: r.components,
+		events:     r.events,
 		route: route{
 			consumers:  make([]Consumer, 0),
 			processors: make([]Processor, 0),
+			inflight:   newInflight(),
+			events:     r.events,
 		},
 	}
 	r.routeConfigurations = append(r.routeConfigurations, routeConfiguration)
@@ -33,9 +40,12 @@ func (r *routeBuilder) From(endpoint Endpoint) RouteConfiguration {
 func (r *routeBuilder) FromS(endpoint string) RouteConfiguration {
 	routeConfiguration := &routeConfiguration{
 		components: r.components,
+		events:     r.events,
 		route: route{
 			consumers:  make([]Consumer, 0),
 			processors: make([]Processor, 0),
+			inflight:   newInflight(),
+			events:     r.events,
 		},
 	}
 	r.routeConfigurations = append(r.routeConfigurations, routeConfiguration)
@@ -52,6 +62,30 @@ type RouteConfiguration interface {
 	RequestReply() RouteConfiguration
 	RequestOnly() RouteConfiguration
 
+	// RouteID names the route so that it can be found with Context.Route.
+	// Routes that are not named are given a random id. Adding a route
+	// whose id is already used in the Context fails.
+	RouteID(id string) RouteConfiguration
+
+	// Description sets a human readable description of the route.
+	Description(text string) RouteConfiguration
+
+	// Group sets the name of the group the route belongs to.
+	Group(name string) RouteConfiguration
+
+	// StartupOrder sets when the route is started relative to the other
+	// routes of the Context. Routes are started in ascending order and
+	// routes without an order are started after them, except that a route
+	// consuming from an endpoint is started before the routes producing to
+	// it. Routes that produce to each other in a cycle are started in
+	// their order.
+	StartupOrder(order int) RouteConfiguration
+
+	// AutoStartup decides whether the route is started with the Context.
+	// Routes that are not started automatically are started with
+	// Context.StartRoute.
+	AutoStartup(auto bool) RouteConfiguration
+
 	To(endpoint Endpoint) RouteConfiguration
 	ToS(endpoint string) RouteConfiguration
 	ToF(endpoint string, args ...interface{}) RouteConfiguration
@@ -59,31 +93,247 @@ type RouteConfiguration interface {
 	Process(processor Processor) RouteConfiguration
 	ProcessFunction(processorFunc ProcessingFunction) RouteConfiguration
 
-	build() Route
+	// OnCompletion opens a sub-route that is run after every exchange
+	// on the route finishes, whether it succeeded or failed. The steps
+	// that follow belong to the sub-route until End is called.
+	OnCompletion() RouteConfiguration
+
+	// OnCompletionWhen opens a sub-route like OnCompletion that is only
+	// run when the outcome of the exchange matches the mode.
+	OnCompletionWhen(mode CompletionMode) RouteConfiguration
+
+	// Filter opens a block whose steps are only run for exchanges that
+	// match the predicate. Exchanges that do not match skip the rest of
+	// the block and continue after End.
+	Filter(predicate Predicate) RouteConfiguration
+
+	// FilterRejectS opens a block like Filter that sends the exchanges
+	// that do not match the predicate to the rejected endpoint.
+	FilterRejectS(predicate Predicate, rejected string) RouteConfiguration
+
+	// Multicast sends an independent copy of the exchange to each of the
+	// endpoints one after the other and uses the reply of the last one
+	// as the out message. The exchange fails with the error of the first
+	// endpoint that failed.
+	Multicast(endpoints ...string) RouteConfiguration
+
+	// MulticastWith sends an independent copy of the exchange to each of
+	// the endpoints as configured by the options.
+	MulticastWith(options MulticastOptions, endpoints ...string) RouteConfiguration
+
+	// RecipientList multicasts the exchange to the endpoints that the
+	// expression evaluates to. The value of the expression can be a
+	// comma separated string or a slice of endpoint strings.
+	RecipientList(expression Expression) RouteConfiguration
+
+	// RecipientListWith is RecipientList with MulticastOptions to
+	// control how the recipients are sent to.
+	RecipientListWith(expression Expression, options MulticastOptions) RouteConfiguration
+
+	// DynamicRouter sends the exchange to the endpoint returned by the
+	// router and calls it again with the result until it returns an
+	// empty string.
+	DynamicRouter(router RouterFunction) RouteConfiguration
+
+	// RoutingSlip sends the exchange to each of the endpoints listed in
+	// the header of the in message in order. An endpoint that cannot be
+	// resolved fails the exchange.
+	RoutingSlip(header string) RouteConfiguration
+
+	// RoutingSlipWith is RoutingSlip with a policy for endpoints that
+	// cannot be resolved.
+	RoutingSlipWith(header string, unknown UnknownEndpointPolicy) RouteConfiguration
+
+	// WireTap sends a copy of the exchange to the endpoint on another
+	// goroutine. The route carries on without waiting and the reply of
+	// the endpoint is discarded.
+	WireTap(endpoint string) RouteConfiguration
+
+	// WireTapWith is WireTap with options for the goroutine pool and for
+	// transforming the copy before it is sent.
+	WireTapWith(endpoint string, options WireTapOptions) RouteConfiguration
+
+	// Enrich sends a copy of the exchange to the endpoint as a request
+	// and merges the reply into the exchange with the strategy. When the
+	// strategy is nil the reply replaces the message of the exchange.
+	Enrich(endpoint string, strategy AggregationStrategy) RouteConfiguration
+
+	// PollEnrich receives a single message from the polling consumer of
+	// the endpoint, waiting up to the timeout, and merges it into the
+	// exchange with the strategy. When the strategy is nil the received
+	// message replaces the message of the exchange. Context.Add fails with
+	// NotAPollingEndpoint if the endpoint cannot create a PollingConsumer.
+	PollEnrich(endpoint string, timeout time.Duration, strategy AggregationStrategy) RouteConfiguration
+
+	// Idempotent opens a block that is skipped by exchanges whose key has
+	// already been seen by the repository. The key is the value of the
+	// expression formatted as a string.
+	Idempotent(key Expression, repository IdempotentRepository) RouteConfiguration
+
+	// IdempotentWith opens a block like Idempotent with options for when
+	// keys are added and removed and for how duplicates are handled.
+	IdempotentWith(key Expression, repository IdempotentRepository, options IdempotentOptions) RouteConfiguration
+
+	// Resequence opens a block that runs its steps for the exchanges in
+	// the order of the sequence number the expression evaluates to. The
+	// exchanges are reordered in batches. Each exchange waits in the
+	// block until its turn so steps that must see the exchanges in order
+	// belong inside the block.
+	Resequence(sequence Expression) RouteConfiguration
+
+	// ResequenceWith opens a block like Resequence with options to select
+	// batch or stream reordering and to size it.
+	ResequenceWith(sequence Expression, options ResequenceOptions) RouteConfiguration
+
+	// LoadBalance opens a block that sends each exchange to only one of
+	// the steps in the block, chosen by the policy selected from the
+	// LoadBalancerBuilder.
+	LoadBalance() LoadBalancerBuilder
+
+	// CircuitBreaker opens a block that stops running its steps after
+	// too many of them fail, with the default CircuitBreakerOptions.
+	CircuitBreaker() RouteConfiguration
+
+	// CircuitBreakerWith opens a block like CircuitBreaker configured by
+	// the options.
+	CircuitBreakerWith(options CircuitBreakerOptions) RouteConfiguration
+
+	// OnFallback ends the steps of the innermost CircuitBreaker block and
+	// starts its fallback steps, which are run instead of the error when
+	// the circuit is open or the steps fail.
+	OnFallback() RouteConfiguration
+
+	// Delay opens a block that holds each exchange until the delay the
+	// expression evaluates to has passed before running the steps of the
+	// block. The value can be a time.Duration, a number of milliseconds,
+	// or a time.Time to wait until.
+	Delay(delay Expression) RouteConfiguration
+
+	// DelayWith opens a block like Delay with options to release the
+	// calling goroutine while waiting and to control what happens to
+	// waiting exchanges when the route stops.
+	DelayWith(delay Expression, options DelayOptions) RouteConfiguration
+
+	// Loop opens a block whose steps are run count times. Each iteration
+	// carries on from the result of the one before it.
+	Loop(count int) RouteConfiguration
+
+	// LoopWith opens a block like Loop with options for how the message
+	// is carried between iterations.
+	LoopWith(count int, options LoopOptions) RouteConfiguration
+
+	// LoopWhile opens a block whose steps are run for as long as the
+	// predicate matches. The predicate is checked before each iteration
+	// and the exchange fails with LoopLimitExceeded if it still matches
+	// after DefaultLoopMaxIterations.
+	LoopWhile(predicate Predicate) RouteConfiguration
+
+	// LoopWhileWith opens a block like LoopWhile with options for how the
+	// message is carried between iterations and how many there may be.
+	LoopWhileWith(predicate Predicate, options LoopOptions) RouteConfiguration
+
+	// ClaimCheck moves the body of the message between the message and
+	// the store. A push replaces the body with a claim token that is also
+	// kept in the header named by the key, and a get or pop restores the
+	// body for the token found under the key.
+	ClaimCheck(operation ClaimCheckOperation, key string, store ClaimCheckStore) RouteConfiguration
+
+	// Saga opens a block that starts a saga, or joins the saga the
+	// exchange is already part of. When the block that started the saga
+	// finishes, the completion endpoints enlisted in the saga are called
+	// if the exchange succeeded or the compensation endpoints are called
+	// in reverse order if it failed.
+	Saga() RouteConfiguration
+
+	// SagaWith opens a block like Saga with options for the coordinator
+	// and the timeout of the saga.
+	SagaWith(options SagaOptions) RouteConfiguration
+
+	// Compensation sets the endpoint the innermost Saga block enlists to
+	// undo its work if the saga fails. It is sent the message the
+	// exchange had when it arrived at the block.
+	Compensation(endpoint string) RouteConfiguration
+
+	// Completion sets the endpoint the innermost Saga block enlists to be
+	// called when the saga succeeds. It is sent the message the exchange
+	// had when it arrived at the block.
+	Completion(endpoint string) RouteConfiguration
+
+	// Transacted opens a block whose steps can enlist resources in a
+	// Transaction found with TransactionOf. The transaction is committed
+	// when the exchange completes successfully and rolled back when it
+	// fails.
+	Transacted(policy TransactionPolicy) RouteConfiguration
+
+	// End closes the most recently opened block such as OnCompletion
+	// and returns to adding steps to the enclosing block or route.
+	End() RouteConfiguration
+
+	build() (Route, error)
+}
+
+// block is a nested list of steps opened by a method of the route
+// configuration and closed by End. While a block is open the steps
+// that are configured are added to the block instead of the route.
+type block interface {
+	add(processor Processor)
+}
+
+// validatingBlock is a block that checks its configuration when it is
+// closed, such as that it has the right number of steps
+type validatingBlock interface {
+	block
+	validate() error
 }
 
 type routeConfiguration struct {
-	components map[string]Component
+	components componentLookup
+	events     *eventNotifiers
 	route      route
+	blocks     []block
+
+	// err is the first configuration error, returned by Context.Add
+	err error
+}
+
+// fail records a configuration error that makes Context.Add fail
+func (r *routeConfiguration) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// add a step to the innermost open block or to the route itself
+func (r *routeConfiguration) add(processor Processor) {
+	if len(r.blocks) > 0 {
+		r.blocks[len(r.blocks)-1].add(processor)
+		return
+	}
+	r.route.processors = append(r.route.processors, processor)
 }
 
 func (r *routeConfiguration) From(endpoint Endpoint) RouteConfiguration {
+	return r.from(endpoint, endpointUri(endpoint))
+}
+
+func (r *routeConfiguration) from(endpoint Endpoint, uri string) RouteConfiguration {
 	producer, err := endpoint.CreateConsumer()
 	if err != nil {
 		// todo: throw error or log? (waiting on choosing a log framework)
 		return r
 	}
 	r.route.consumers = append(r.route.consumers, producer)
+	r.route.uris = append(r.route.uris, uri)
 	return r
 }
 
 func (r *routeConfiguration) FromS(endpoint string) RouteConfiguration {
-	// get prefix
-	idx := strings.Index(endpoint, ":")
-	if value, found := r.components[endpoint[0:idx]]; found {
-		return r.From(value.CreateEndpoint(endpoint, map[string]string{}))
+	resolved, err := resolveEndpoint(r.components, endpoint)
+	if err != nil {
+		// todo: throw error or log? (waiting on choosing a log framework)
+		return r
 	}
-	return r
+	return r.from(resolved, endpoint)
 }
 
 func (r *routeConfiguration) FromF(endpoint string, args ...interface{}) RouteConfiguration {
@@ -93,19 +343,23 @@ func (r *routeConfiguration) FromF(endpoint string, args ...interface{}) RouteCo
 func (r *routeConfiguration) To(endpoint Endpoint) RouteConfiguration {
 	consumer, err := endpoint.CreateProducer()
 	if err != nil {
-		// todo: throw error or log? (waiting on choosing a log framework)
+		r.fail(err)
 		return r
 	}
-	r.route.processors = append(r.route.processors, consumer)
+	r.step("to", endpointUri(endpoint))
+	r.route.producerUris = append(r.route.producerUris, endpointUri(endpoint))
+	r.add(newSendingProducer(consumer, endpointUri(endpoint), &r.route.id, r.events))
 	return r
 }
 
 func (r *routeConfiguration) ToS(endpoint string) RouteConfiguration {
-	// get prefix
-	idx := strings.Index(endpoint, ":")
-	if value, found := r.components[endpoint[0:idx]]; found {
-		return r.To(value.CreateEndpoint(endpoint, map[string]string{}))
+	producer, err := r.producer(endpoint)
+	if err != nil {
+		// todo: throw error or log? (waiting on choosing a log framework)
+		return r
 	}
+	r.step("to", endpoint)
+	r.add(producer)
 	return r
 }
 
@@ -114,7 +368,8 @@ func (r *routeConfiguration) ToF(endpoint string, args ...interface{}) RouteConf
 }
 
 func (r *routeConfiguration) Process(processor Processor) RouteConfiguration {
-	r.route.processors = append(r.route.processors, processor)
+	r.step("process")
+	r.add(processor)
 	return r
 }
 
@@ -138,70 +393,638 @@ func (r *routeConfiguration) RequestOnly() RouteConfiguration {
 	return r
 }
 
-func (r *routeConfiguration) build() Route {
-	r.route.id = generator.Hex128()
-	return &r.route
+func (r *routeConfiguration) RouteID(id string) RouteConfiguration {
+	r.route.id = id
+	return r
+}
+
+func (r *routeConfiguration) Description(text string) RouteConfiguration {
+	r.route.description = text
+	return r
+}
+
+func (r *routeConfiguration) Group(name string) RouteConfiguration {
+	r.route.group = name
+	return r
+}
+
+func (r *routeConfiguration) StartupOrder(order int) RouteConfiguration {
+	r.route.startupOrder = order
+	return r
+}
+
+func (r *routeConfiguration) AutoStartup(auto bool) RouteConfiguration {
+	r.route.manualStartup = !auto
+	return r
+}
+
+func (r *routeConfiguration) OnCompletion() RouteConfiguration {
+	return r.OnCompletionWhen(CompleteAlways)
+}
+
+func (r *routeConfiguration) OnCompletionWhen(mode CompletionMode) RouteConfiguration {
+	completion := &onCompletion{
+		mode:       mode,
+		processors: make(pipeline, 0),
+	}
+	r.route.completions = append(r.route.completions, completion)
+	r.step("onCompletion")
+	return r.open(completion)
+}
+
+func (r *routeConfiguration) Filter(predicate Predicate) RouteConfiguration {
+	r.step("filter")
+	return r.open(&filter{
+		predicate:  predicate,
+		processors: make(pipeline, 0),
+	})
+}
+
+func (r *routeConfiguration) FilterRejectS(predicate Predicate, rejected string) RouteConfiguration {
+	producer, err := r.producer(rejected)
+	if err != nil {
+		// todo: throw error or log? (waiting on choosing a log framework)
+		return r.Filter(predicate)
+	}
+	r.step("filter", rejected)
+	return r.open(&filter{
+		predicate:  predicate,
+		processors: make(pipeline, 0),
+		rejected:   producer,
+	})
+}
+
+func (r *routeConfiguration) Multicast(endpoints ...string) RouteConfiguration {
+	return r.MulticastWith(MulticastOptions{}, endpoints...)
+}
+
+func (r *routeConfiguration) MulticastWith(options MulticastOptions, endpoints ...string) RouteConfiguration {
+	producers := make([]Producer, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		producer, err := r.producer(endpoint)
+		if err != nil {
+			// todo: throw error or log? (waiting on choosing a log framework)
+			continue
+		}
+		producers = append(producers, producer)
+	}
+	r.step("multicast", endpoints...)
+	r.add(newMulticast(options, producers))
+	return r
+}
+
+func (r *routeConfiguration) RecipientList(expression Expression) RouteConfiguration {
+	return r.RecipientListWith(expression, MulticastOptions{})
+}
+
+func (r *routeConfiguration) RecipientListWith(expression Expression, options MulticastOptions) RouteConfiguration {
+	r.step("recipientList")
+	r.add(&recipientList{
+		expression: expression,
+		multicast:  newMulticast(options, nil),
+		cache:      r.producerCache(),
+	})
+	return r
+}
+
+func (r *routeConfiguration) DynamicRouter(router RouterFunction) RouteConfiguration {
+	r.step("dynamicRouter")
+	r.add(&dynamicRouter{
+		router: router,
+		cache:  r.producerCache(),
+	})
+	return r
+}
+
+func (r *routeConfiguration) RoutingSlip(header string) RouteConfiguration {
+	return r.RoutingSlipWith(header, FailUnknownEndpoints)
+}
+
+func (r *routeConfiguration) RoutingSlipWith(header string, unknown UnknownEndpointPolicy) RouteConfiguration {
+	r.step("routingSlip", header)
+	r.add(&routingSlip{
+		header:  header,
+		unknown: unknown,
+		cache:   r.producerCache(),
+	})
+	return r
+}
+
+func (r *routeConfiguration) WireTap(endpoint string) RouteConfiguration {
+	return r.WireTapWith(endpoint, WireTapOptions{})
+}
+
+func (r *routeConfiguration) WireTapWith(endpoint string, options WireTapOptions) RouteConfiguration {
+	producer, err := r.producer(endpoint)
+	if err != nil {
+		// todo: throw error or log? (waiting on choosing a log framework)
+		return r
+	}
+	r.step("wireTap", endpoint)
+	r.add(newWireTap(producer, options))
+	return r
+}
+
+func (r *routeConfiguration) Enrich(endpoint string, strategy AggregationStrategy) RouteConfiguration {
+	producer, err := r.producer(endpoint)
+	if err != nil {
+		// todo: throw error or log? (waiting on choosing a log framework)
+		return r
+	}
+	r.step("enrich", endpoint)
+	r.add(&enrich{
+		producer: producer,
+		strategy: strategy,
+	})
+	return r
+}
+
+func (r *routeConfiguration) PollEnrich(endpoint string, timeout time.Duration, strategy AggregationStrategy) RouteConfiguration {
+	resolved, err := resolveEndpoint(r.components, endpoint)
+	if err != nil {
+		// todo: throw error or log? (waiting on choosing a log framework)
+		return r
+	}
+	polling, ok := resolved.(PollingEndpoint)
+	if !ok {
+		r.fail(NotAPollingEndpoint{})
+		return r
+	}
+	consumer, err := polling.CreatePollingConsumer()
+	if err != nil {
+		r.fail(err)
+		return r
+	}
+	r.step("pollEnrich", endpoint)
+	r.add(&pollEnrich{
+		consumer: consumer,
+		timeout:  timeout,
+		strategy: strategy,
+	})
+	return r
+}
+
+func (r *routeConfiguration) Idempotent(key Expression, repository IdempotentRepository) RouteConfiguration {
+	return r.IdempotentWith(key, repository, IdempotentOptions{})
+}
+
+func (r *routeConfiguration) IdempotentWith(key Expression, repository IdempotentRepository, options IdempotentOptions) RouteConfiguration {
+	r.step("idempotent")
+	return r.open(&idempotent{
+		key:        key,
+		repository: repository,
+		options:    options,
+		processors: make(pipeline, 0),
+	})
+}
+
+func (r *routeConfiguration) Resequence(sequence Expression) RouteConfiguration {
+	return r.ResequenceWith(sequence, ResequenceOptions{})
+}
+
+func (r *routeConfiguration) ResequenceWith(sequence Expression, options ResequenceOptions) RouteConfiguration {
+	r.step("resequence")
+	return r.open(newResequencer(sequence, options))
+}
+
+func (r *routeConfiguration) LoadBalance() LoadBalancerBuilder {
+	r.step("loadBalance")
+	return &loadBalancerBuilder{
+		configuration: r,
+	}
+}
+
+func (r *routeConfiguration) CircuitBreaker() RouteConfiguration {
+	return r.CircuitBreakerWith(CircuitBreakerOptions{})
+}
+
+func (r *routeConfiguration) CircuitBreakerWith(options CircuitBreakerOptions) RouteConfiguration {
+	r.step("circuitBreaker")
+	return r.open(newCircuitBreaker(options))
+}
+
+func (r *routeConfiguration) OnFallback() RouteConfiguration {
+	if len(r.blocks) > 0 {
+		if breaker, ok := r.blocks[len(r.blocks)-1].(*circuitBreaker); ok {
+			r.step("onFallback")
+			breaker.inFallback = true
+		}
+	}
+	return r
+}
+
+func (r *routeConfiguration) Delay(delay Expression) RouteConfiguration {
+	return r.DelayWith(delay, DelayOptions{})
+}
+
+func (r *routeConfiguration) DelayWith(delay Expression, options DelayOptions) RouteConfiguration {
+	r.step("delay")
+	return r.open(newDelayer(delay, options))
+}
+
+func (r *routeConfiguration) Loop(count int) RouteConfiguration {
+	return r.LoopWith(count, LoopOptions{})
+}
+
+func (r *routeConfiguration) LoopWith(count int, options LoopOptions) RouteConfiguration {
+	r.step("loop", fmt.Sprint(count))
+	return r.open(&loop{
+		count:      count,
+		options:    options,
+		processors: make(pipeline, 0),
+	})
+}
+
+func (r *routeConfiguration) LoopWhile(predicate Predicate) RouteConfiguration {
+	return r.LoopWhileWith(predicate, LoopOptions{})
+}
+
+func (r *routeConfiguration) LoopWhileWith(predicate Predicate, options LoopOptions) RouteConfiguration {
+	if options.MaxIterations <= 0 {
+		options.MaxIterations = DefaultLoopMaxIterations
+	}
+	r.step("loopWhile")
+	return r.open(&loop{
+		predicate:  predicate,
+		options:    options,
+		processors: make(pipeline, 0),
+	})
+}
+
+func (r *routeConfiguration) ClaimCheck(operation ClaimCheckOperation, key string, store ClaimCheckStore) RouteConfiguration {
+	r.step("claimCheck", key)
+	r.add(&claimCheck{
+		operation: operation,
+		key:       key,
+		store:     store,
+	})
+	return r
+}
+
+func (r *routeConfiguration) Saga() RouteConfiguration {
+	return r.SagaWith(SagaOptions{})
+}
+
+func (r *routeConfiguration) SagaWith(options SagaOptions) RouteConfiguration {
+	if options.Coordinator == nil {
+		options.Coordinator = DefaultSagaCoordinator
+	}
+	r.step("saga")
+	return r.open(&sagaBlock{
+		options:    options,
+		components: r.components,
+		processors: make(pipeline, 0),
+	})
+}
+
+func (r *routeConfiguration) Compensation(endpoint string) RouteConfiguration {
+	if block := r.innermostSaga(); block != nil {
+		producer, err := r.producer(endpoint)
+		if err != nil {
+			// todo: throw error or log? (waiting on choosing a log framework)
+			return r
+		}
+		r.step("compensation", endpoint)
+		block.step.compensation = producer
+		block.step.compensationEndpoint = endpoint
+	}
+	return r
+}
+
+func (r *routeConfiguration) Completion(endpoint string) RouteConfiguration {
+	if block := r.innermostSaga(); block != nil {
+		producer, err := r.producer(endpoint)
+		if err != nil {
+			// todo: throw error or log? (waiting on choosing a log framework)
+			return r
+		}
+		r.step("completion", endpoint)
+		block.step.completion = producer
+		block.step.completionEndpoint = endpoint
+	}
+	return r
+}
+
+func (r *routeConfiguration) innermostSaga() *sagaBlock {
+	for idx := len(r.blocks) - 1; idx >= 0; idx-- {
+		if block, ok := r.blocks[idx].(*sagaBlock); ok {
+			return block
+		}
+	}
+	return nil
+}
+
+func (r *routeConfiguration) Transacted(policy TransactionPolicy) RouteConfiguration {
+	if policy.Manager == nil {
+		policy.Manager = DefaultTransactionManager
+	}
+	r.step("transacted")
+	return r.open(&transacted{
+		policy:     policy,
+		processors: make(pipeline, 0),
+	})
+}
+
+// open adds a block as a step of the route and sends the steps that
+// follow to the block until End is called
+func (r *routeConfiguration) open(b block) RouteConfiguration {
+	if processor, ok := b.(Processor); ok {
+		r.add(processor)
+	}
+	r.blocks = append(r.blocks, b)
+	return r
+}
+
+// producer resolves the endpoint string and creates a Producer for it
+func (r *routeConfiguration) producer(endpoint string) (Producer, error) {
+	resolved, err := resolveEndpoint(r.components, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	producer, err := resolved.CreateProducer()
+	if err != nil {
+		// the endpoint exists but is configured incorrectly
+		r.fail(err)
+		return nil, err
+	}
+	r.route.producerUris = append(r.route.producerUris, endpoint)
+	return newSendingProducer(producer, endpoint, &r.route.id, r.events), nil
+}
+
+// producerCache creates a cache for the endpoints of a step that are only
+// known at runtime
+func (r *routeConfiguration) producerCache() *producerCache {
+	cache := newProducerCache(r.components)
+	cache.routeId = &r.route.id
+	cache.events = r.events
+	return cache
+}
+
+// step describes a step of the route for RouteInfo. Steps inside of
+// blocks are indented by the depth of the block.
+func (r *routeConfiguration) step(name string, details ...string) {
+	description := strings.Repeat("  ", len(r.blocks)) + name
+	if len(details) > 0 {
+		description += "(" + strings.Join(details, ", ") + ")"
+	}
+	r.route.steps = append(r.route.steps, description)
+}
+
+func (r *routeConfiguration) End() RouteConfiguration {
+	if len(r.blocks) > 0 {
+		r.close(r.blocks[len(r.blocks)-1])
+		r.blocks = r.blocks[:len(r.blocks)-1]
+	}
+	return r
+}
+
+func (r *routeConfiguration) close(b block) {
+	if validating, ok := b.(validatingBlock); ok {
+		if err := validating.validate(); err != nil {
+			r.fail(err)
+		}
+	}
+}
+
+// build the route, returning the first configuration error if there was
+// one. Blocks that were never closed with End are validated as well.
+func (r *routeConfiguration) build() (Route, error) {
+	for idx := len(r.blocks) - 1; idx >= 0; idx-- {
+		r.close(r.blocks[idx])
+	}
+	r.blocks = nil
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.route.id == "" {
+		r.route.id = generator.Hex128()
+	}
+	return &r.route, nil
 }
 
 type Route interface {
 	ConsumingService
+
+	Id() string
+
+	// Info describes the route and its current status.
+	Info() RouteInfo
+
+	change(to RouteStatus, from ...RouteStatus) error
+	shutdown(ctx gocontext.Context) error
+	remove() error
 }
 
 type route struct {
-	id        string
-	pattern   string
-	initiator Initiator
+	id          string
+	description string
+	group       string
+	uris        []string
+	steps       []string
 
-	consumers  []Consumer
-	processors []Processor
+	producerUris  []string
+	startupOrder  int
+	manualStartup bool
+	pattern       string
+	initiator     Initiator
+
+	// lifecycle is held while the route changes status and lock while
+	// the status is read or written
+	lifecycle sync.Mutex
+	lock      sync.RWMutex
+	status    RouteStatus
+
+	consumers   []Consumer
+	processors  pipeline
+	completions []*onCompletion
+	inflight    *inflight
+	events      *eventNotifiers
+}
+
+func (r *route) Id() string {
+	return r.id
+}
+
+func (r *route) Info() RouteInfo {
+	return RouteInfo{
+		Id:           r.id,
+		Description:  r.description,
+		Group:        r.group,
+		Consumers:    append([]string(nil), r.uris...),
+		Steps:        append([]string(nil), r.steps...),
+		Producers:    append([]string(nil), r.producerUris...),
+		StartupOrder: r.startupOrder,
+		AutoStartup:  !r.manualStartup,
+		Status:       r.Status(),
+	}
+}
+
+func (r *route) Status() RouteStatus {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.status
+}
+
+func (r *route) setStatus(status RouteStatus) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.status = status
 }
 
 func (r *route) Init() {
 	for _, f := range r.consumers {
 		f.Init()
 	}
-	for _, s := range r.processors {
-		if c, ok := s.(Producer); ok {
-			c.Init()
-		}
+	r.processors.Init()
+	for _, c := range r.completions {
+		c.processors.Init()
 	}
 }
 
+// Start the route if it is initialized or stopped. Use Context.StartRoute
+// to find out why a route could not be started.
 func (r *route) Start() {
-	r.initiator = &routeInitiator{
-		route: r,
-	}
+	_ = r.change(RouteStarted, RouteInitialized, RouteStopped)
+}
 
-	for _, producer := range r.consumers {
-		producer.Start(r.initiator)
+// Stop the route if it is started or suspended.
+func (r *route) Stop() {
+	_ = r.change(RouteStopped, RouteStarted, RouteSuspended)
+}
+
+// change moves the route to the status if its current status is one of
+// the statuses it can be moved from, and returns InvalidRouteTransition
+// otherwise. Stopping waits up to DefaultShutdownTimeout for the in-flight
+// exchanges of the route.
+func (r *route) change(to RouteStatus, from ...RouteStatus) error {
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), DefaultShutdownTimeout)
+	defer cancel()
+	return r.transition(ctx, to, from...)
+}
+
+// shutdown stops the route if it is started or suspended, waiting for
+// the in-flight exchanges of the route until the Go context is done.
+func (r *route) shutdown(ctx gocontext.Context) error {
+	return r.transition(ctx, RouteStopped, RouteStarted, RouteSuspended)
+}
+
+func (r *route) transition(ctx gocontext.Context, to RouteStatus, from ...RouteStatus) error {
+	r.lifecycle.Lock()
+	defer r.lifecycle.Unlock()
+
+	current := r.Status()
+	allowed := false
+	for _, status := range from {
+		allowed = allowed || status == current
+	}
+	if !allowed {
+		return InvalidRouteTransition{Id: r.id, From: current, To: to}
 	}
 
-	for _, s := range r.processors {
-		if c, ok := s.(Producer); ok {
-			c.Start()
+	switch {
+	case to == RouteStarted && current == RouteSuspended:
+		if err := r.startConsumers(); err != nil {
+			return err
+		}
+	case to == RouteStarted:
+		r.initiator = &routeInitiator{
+			route: r,
+		}
+		if err := r.startConsumers(); err != nil {
+			return err
+		}
+		r.processors.Start()
+		for _, c := range r.completions {
+			c.processors.Start()
+		}
+	case to == RouteSuspended:
+		r.stopConsumers()
+	case to == RouteStopped:
+		// stop taking new exchanges, give the exchanges in flight the
+		// chance to complete, then stop the steps in reverse order
+		if current != RouteSuspended {
+			r.stopConsumers()
 		}
+		abandoned := r.inflight.wait(ctx)
+		for idx := len(r.completions) - 1; idx >= 0; idx-- {
+			r.completions[idx].processors.Stop()
+		}
+		r.processors.Stop()
+		r.setStatus(to)
+		r.notify(to)
+		if len(abandoned) > 0 {
+			return AbandonedExchanges{
+				Err:       ctx.Err(),
+				Exchanges: map[string][]string{r.id: abandoned},
+			}
+		}
+		return nil
 	}
+	r.setStatus(to)
+	r.notify(to)
+	return nil
 }
 
-func (r *route) Stop() {
-	for _, f := range r.consumers {
-		f.Stop()
+// notify the event notifiers that the route changed to the status
+func (r *route) notify(status RouteStatus) {
+	if !r.events.enabled() {
+		return
+	}
+	base := BaseEvent{Time: time.Now()}
+	switch status {
+	case RouteStarted:
+		r.events.notify(RouteStartedEvent{BaseEvent: base, Route: r.Info()})
+	case RouteStopped:
+		r.events.notify(RouteStoppedEvent{BaseEvent: base, Route: r.Info()})
 	}
-	for _, s := range r.processors {
-		if c, ok := s.(Producer); ok {
-			c.Stop()
+}
+
+// startConsumers starts every consumer of the route. If one of them
+// refuses to start then the consumers that were started are stopped again
+// and the error is returned.
+func (r *route) startConsumers() error {
+	for idx, consumer := range r.consumers {
+		checked, ok := consumer.(CheckedConsumer)
+		if !ok {
+			consumer.Start(r.initiator)
+			continue
 		}
+		if err := checked.TryStart(r.initiator); err != nil {
+			for started := idx - 1; started >= 0; started-- {
+				r.consumers[started].Stop()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *route) stopConsumers() {
+	for _, consumer := range r.consumers {
+		consumer.Stop()
+	}
+}
+
+// remove closes the route if it is initialized or stopped so that it can
+// be removed from the Context.
+func (r *route) remove() error {
+	r.lifecycle.Lock()
+	defer r.lifecycle.Unlock()
+	if current := r.Status(); current != RouteInitialized && current != RouteStopped {
+		return InvalidRouteTransition{Id: r.id, From: current, To: RouteRemoved}
 	}
+	r.Close()
+	r.setStatus(RouteRemoved)
+	return nil
 }
 
 func (r *route) Close() {
 	for _, f := range r.consumers {
 		f.Close()
 	}
-	for _, s := range r.processors {
-		if c, ok := s.(Producer); ok {
-			c.Close()
-		}
+	r.processors.Close()
+	for _, c := range r.completions {
+		c.processors.Close()
 	}
 }
 
@@ -210,23 +1033,63 @@ type routeInitiator struct {
 }
 
 func (r *routeInitiator) Exchange(in Message) Exchange {
-	// create initial exchange
-	exchange := NewExchangeWithPattern(r.route.pattern)
+	// create initial exchange, continuing the breadcrumb of the
+	// message if the consumer provided one
+	exchange := NewExchangeWithPattern(r.route.pattern).(*exchange)
+	if in != nil && in.Headers() != nil {
+		if breadcrumb, ok := (*in.Headers())[BreadcrumbHeader].(string); ok && breadcrumb != "" {
+			exchange.breadcrumbId = breadcrumb
+		}
+	}
+	return r.process(exchange, in)
+}
+
+func (r *routeInitiator) ExchangeWithParent(parent Exchange) Exchange {
+	return r.process(newChildExchange(parent, r.route.pattern), parent.In())
+}
+
+func (r *routeInitiator) process(exchange Exchange, in Message) Exchange {
+	r.route.inflight.add(exchange)
+	defer r.route.inflight.remove(exchange)
+	events := r.route.events
+	if events.enabled() {
+		events.notify(ExchangeCreatedEvent{
+			BaseEvent: BaseEvent{Time: time.Now()},
+			RouteId:   r.route.id,
+			Exchange:  exchange,
+		})
+	}
+
 	exchange.Out(in)
 	exchange.rotate()
 
+	// register the route level completion sub-routes before any
+	// step can add its own callbacks
+	for _, c := range r.route.completions {
+		exchange.AddOnCompletionWhen(c.mode, c.run)
+	}
+
 	// for each step handle the in/out at each step, essentially
 	// rotating the out message to be the in message for the
 	// next step
-	for idx := 0; idx < len(r.route.processors); idx++ {
-		if r.route.processors[idx] != nil {
-			r.route.processors[idx].Process(exchange)
-			exchange.rotate()
-		}
+	r.route.processors.Process(exchange)
+
+	// report the outcome once the exchange has completed, which can be
+	// after it is returned if it is held by an asynchronous step
+	if events.enabled() {
+		exchange.addAfterCompletion(func(exchange Exchange, err error) {
+			base := BaseEvent{Time: time.Now()}
+			if err != nil {
+				events.notify(ExchangeFailedEvent{BaseEvent: base, RouteId: r.route.id, Exchange: exchange, Err: err})
+			} else {
+				events.notify(ExchangeCompletedEvent{BaseEvent: base, RouteId: r.route.id, Exchange: exchange})
+			}
+		})
 	}
 
-	// rotate and return the exchange
+	// rotate, complete, and return the exchange
 	exchange.rotate()
+	exchange.complete()
 	return exchange
 }
 
@@ -0,0 +1,106 @@
+package core
+
+import "fmt"
+
+// RouteStatus is the lifecycle status of a route.
+type RouteStatus int
+
+const (
+	// RouteInitialized is the status of a route that has been added to
+	// the Context but not started.
+	RouteInitialized RouteStatus = iota
+	RouteStarted
+
+	// RouteSuspended is the status of a route whose consumers are stopped
+	// while the rest of the route stays started so that it can be resumed
+	// quickly.
+	RouteSuspended
+	RouteStopped
+
+	// RouteRemoved is the status of a route that has been removed from the
+	// Context.
+	RouteRemoved
+)
+
+func (r RouteStatus) String() string {
+	switch r {
+	case RouteInitialized:
+		return "Initialized"
+	case RouteStarted:
+		return "Started"
+	case RouteSuspended:
+		return "Suspended"
+	case RouteStopped:
+		return "Stopped"
+	case RouteRemoved:
+		return "Removed"
+	}
+	return fmt.Sprintf("RouteStatus(%d)", int(r))
+}
+
+// RouteInfo is a read-only description of a route added to a Context.
+type RouteInfo struct {
+	Id          string
+	Description string
+	Group       string
+
+	// Consumers are the endpoints the route consumes from.
+	Consumers []string
+
+	// Steps describe the steps of the route in order. The steps inside of
+	// a block are indented below the step that opened the block.
+	Steps []string
+
+	// Producers are the endpoints the steps of the route produce to,
+	// except for the endpoints that are only known while an exchange is
+	// processed such as those of a RecipientList.
+	Producers []string
+
+	// StartupOrder is the order set with RouteConfiguration.StartupOrder
+	// or 0 if none was set.
+	StartupOrder int
+	AutoStartup  bool
+
+	Status RouteStatus
+}
+
+// DuplicateRouteId is the error returned by Context.Add when a route uses
+// the id of another route.
+type DuplicateRouteId struct {
+	Id string
+}
+
+func (d DuplicateRouteId) Error() string {
+	return fmt.Sprintf("A route with the id %s already exists", d.Id)
+}
+
+// endpointUri describes an Endpoint that was not given as a string.
+func endpointUri(endpoint Endpoint) string {
+	if stringer, ok := endpoint.(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return fmt.Sprintf("%T", endpoint)
+}
+
+// UnknownRoute is the error returned when there is no route with the id
+// in the Context.
+type UnknownRoute struct {
+	Id string
+}
+
+func (u UnknownRoute) Error() string {
+	return fmt.Sprintf("There is no route with the id %s", u.Id)
+}
+
+// InvalidRouteTransition is the error returned when a route cannot be
+// moved from its current status to the requested one, such as resuming a
+// route that is not suspended.
+type InvalidRouteTransition struct {
+	Id   string
+	From RouteStatus
+	To   RouteStatus
+}
+
+func (i InvalidRouteTransition) Error() string {
+	return fmt.Sprintf("Route %s cannot change from %s to %s", i.Id, i.From, i.To)
+}
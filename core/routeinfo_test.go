@@ -0,0 +1,69 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteInfo(t *testing.T) {
+	context, _ := newTestContext()
+	err := context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:in").
+			FromS("test:other").
+			RouteID("orders").
+			Description("Accepts orders").
+			Group("sales").
+			Filter(HeaderEquals("type", "order")).
+			ToS("test:accepted").
+			End().
+			ToS("test:audit")
+		builder.FromS("test:unnamed").ToS("test:out")
+	})
+	assert.Nil(t, err)
+
+	info, found := context.Route("orders")
+	assert.True(t, found)
+	assert.Equal(t, "orders", info.Id)
+	assert.Equal(t, "Accepts orders", info.Description)
+	assert.Equal(t, "sales", info.Group)
+	assert.Equal(t, []string{"test:in", "test:other"}, info.Consumers)
+	assert.Equal(t, []string{"filter", "  to(test:accepted)", "to(test:audit)"}, info.Steps)
+	assert.Equal(t, RouteInitialized, info.Status)
+
+	routes := context.Routes()
+	assert.Equal(t, 2, len(routes))
+	assert.Equal(t, "orders", routes[0].Id)
+	assert.NotEmpty(t, routes[1].Id)
+
+	context.Start()
+	info, _ = context.Route("orders")
+	assert.Equal(t, RouteStarted, info.Status)
+	context.Stop()
+	info, _ = context.Route("orders")
+	assert.Equal(t, RouteStopped, info.Status)
+
+	_, found = context.Route("missing")
+	assert.False(t, found)
+}
+
+func TestDuplicateRouteId(t *testing.T) {
+	context, _ := newTestContext()
+	assert.Nil(t, context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:a").RouteID("a").ToS("test:out")
+	}))
+
+	err := context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:b").RouteID("b").ToS("test:out")
+		builder.FromS("test:c").RouteID("a").ToS("test:out")
+	})
+	assert.Equal(t, DuplicateRouteId{Id: "a"}, err)
+	assert.Equal(t, 1, len(context.Routes()))
+
+	err = context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:b").RouteID("b").ToS("test:out")
+		builder.FromS("test:c").RouteID("b").ToS("test:out")
+	})
+	assert.Equal(t, DuplicateRouteId{Id: "b"}, err)
+	assert.Equal(t, 1, len(context.Routes()))
+}
@@ -0,0 +1,59 @@
+package core
+
+// UnknownEndpointPolicy decides what a step that computes its endpoints at
+// runtime does with an endpoint string that cannot be resolved.
+type UnknownEndpointPolicy int
+
+const (
+	// FailUnknownEndpoints fails the exchange with an UnknownEndpoint
+	// error.
+	FailUnknownEndpoints UnknownEndpointPolicy = iota
+
+	// IgnoreUnknownEndpoints skips the endpoint and carries on with the
+	// rest of the endpoints.
+	IgnoreUnknownEndpoints
+)
+
+// routingSlip sends the exchange to each endpoint listed in a header of the
+// in message in turn, rotating the out message to the in message after each
+// step. The list is read once when the exchange arrives at the slip.
+type routingSlip struct {
+	header  string
+	unknown UnknownEndpointPolicy
+	cache   *producerCache
+}
+
+func (r *routingSlip) Process(exchange Exchange) {
+	endpoints := endpointList(Header(r.header)(exchange))
+	for _, endpoint := range endpoints {
+		producer, err := r.cache.get(endpoint)
+		if err != nil {
+			if r.unknown == IgnoreUnknownEndpoints {
+				continue
+			}
+			exchange.SetError(err)
+			return
+		}
+		producer.Process(exchange)
+		exchange.rotate()
+		if exchange.Error() != nil {
+			return
+		}
+	}
+}
+
+func (r *routingSlip) Init() {
+	r.cache.Init()
+}
+
+func (r *routingSlip) Start() {
+	r.cache.Start()
+}
+
+func (r *routingSlip) Stop() {
+	r.cache.Stop()
+}
+
+func (r *routingSlip) Close() {
+	r.cache.Close()
+}
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutingSlip(t *testing.T) {
+	context, component := newTestContext()
+	component.handle("test:ocr", func(exchange Exchange) {
+		exchange.Out(NewTextMessage(exchange.In().Body().(string) + "+ocr"))
+	})
+	component.handle("test:index", func(exchange Exchange) {
+		exchange.Out(NewTextMessage(exchange.In().Body().(string) + "+index"))
+	})
+
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:strict").RequestReply().RoutingSlip("plan").ToS("test:done")
+		builder.FromS("test:lenient").RequestReply().RoutingSlipWith("plan", IgnoreUnknownEndpoints)
+	})
+	context.Start()
+
+	plan := func(steps ...string) Message {
+		message := NewTextMessage("doc")
+		(*message.Headers())["plan"] = steps
+		return message
+	}
+
+	exchange := component.send("test:strict", plan("test:ocr", "test:index"))
+	assert.Nil(t, exchange.Error())
+	assert.Equal(t, "doc+ocr+index", exchange.In().Body())
+	assert.Equal(t, "doc+ocr", component.received["test:index"][0].Body())
+
+	exchange = component.send("test:strict", plan("test:ocr", "missing:step", "test:index"))
+	assert.IsType(t, UnknownEndpoint{}, exchange.Error())
+	assert.Equal(t, 1, component.count("test:index"))
+	assert.Equal(t, 1, component.count("test:done"))
+
+	exchange = component.send("test:lenient", plan("missing:step", "test:index"))
+	assert.Nil(t, exchange.Error())
+	assert.Equal(t, "doc+index", exchange.In().Body())
+}
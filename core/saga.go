@@ -0,0 +1,337 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// SagaIdProperty is the exchange property holding the id of the saga
+	// the exchange is part of. Child exchanges get a copy of it so routes
+	// called through direct endpoints join the same saga.
+	SagaIdProperty = "SagaId"
+
+	// SagaIdHeader is the header holding the id of the saga on the
+	// messages sent to compensation and completion endpoints.
+	SagaIdHeader = "sagaId"
+
+	// the exchange property holding the coordinator of the saga so that
+	// blocks joining the saga use the coordinator that started it
+	sagaCoordinatorProperty = "SagaCoordinator"
+)
+
+// SagaNotActive is the error set on an exchange when the saga it is part
+// of has already been compensated, most often because it timed out.
+type SagaNotActive struct {
+	Id string
+}
+
+func (s SagaNotActive) Error() string {
+	return fmt.Sprintf("The saga %s is no longer active", s.Id)
+}
+
+// SagaOptions configure a Saga block.
+type SagaOptions struct {
+	// Coordinator tracks the saga. DefaultSagaCoordinator is used when
+	// it is not set.
+	Coordinator *SagaCoordinator
+
+	// Timeout compensates the saga if it has not finished within it. Zero
+	// means there is no timeout. It only applies to a block that starts a
+	// saga and not to one that joins an existing saga.
+	Timeout time.Duration
+}
+
+// DefaultSagaCoordinator is the in-memory coordinator used by Saga blocks
+// that do not set one.
+var DefaultSagaCoordinator = NewSagaCoordinator(nil)
+
+// a step enlisted in a saga along with the message it was enlisted with
+type sagaStep struct {
+	compensation         Producer
+	completion           Producer
+	compensationEndpoint string
+	completionEndpoint   string
+	message              Message
+}
+
+type saga struct {
+	steps []sagaStep
+	timer *time.Timer
+}
+
+// A SagaCoordinator keeps track of the sagas that are running and of the
+// steps enlisted in them so that it can complete or compensate them. With
+// a SagaJournal it records what it does so that sagas left unfinished by a
+// restart can be compensated.
+type SagaCoordinator struct {
+	lock      sync.Mutex
+	journal   SagaJournal
+	sagas     map[string]*saga
+	recovered bool
+}
+
+// NewSagaCoordinator creates a SagaCoordinator that records what it does
+// in the journal. The journal can be nil to keep the sagas only in memory.
+func NewSagaCoordinator(journal SagaJournal) *SagaCoordinator {
+	return &SagaCoordinator{
+		journal: journal,
+		sagas:   make(map[string]*saga),
+	}
+}
+
+func (s *SagaCoordinator) begin(timeout time.Duration) (string, error) {
+	id := generator.Hex128()
+	if err := s.record(SagaEntry{Saga: id, Event: SagaBegun}); err != nil {
+		return "", err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	started := &saga{}
+	if timeout > 0 {
+		started.timer = time.AfterFunc(timeout, func() {
+			_ = s.compensate(id)
+		})
+	}
+	s.sagas[id] = started
+	return id, nil
+}
+
+func (s *SagaCoordinator) enlist(id string, step sagaStep) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	running, found := s.sagas[id]
+	if !found {
+		return SagaNotActive{Id: id}
+	}
+	entry := SagaEntry{
+		Saga:         id,
+		Event:        SagaEnlisted,
+		Compensation: step.compensationEndpoint,
+		Completion:   step.completionEndpoint,
+	}
+	if step.message != nil {
+		entry.Body = step.message.Body()
+	}
+	if err := s.record(entry); err != nil {
+		return err
+	}
+	running.steps = append(running.steps, step)
+	return nil
+}
+
+// finish removes the saga so that it is only completed or compensated once
+func (s *SagaCoordinator) finish(id string) (*saga, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	finished, found := s.sagas[id]
+	if !found {
+		return nil, SagaNotActive{Id: id}
+	}
+	delete(s.sagas, id)
+	if finished.timer != nil {
+		finished.timer.Stop()
+	}
+	return finished, nil
+}
+
+// complete sends every completion in the order the steps were enlisted
+func (s *SagaCoordinator) complete(id string) error {
+	finished, err := s.finish(id)
+	if err != nil {
+		return err
+	}
+	for _, step := range finished.steps {
+		if step.completion != nil {
+			err = firstError(err, s.send(id, step.completion, step.message))
+		}
+	}
+	return firstError(err, s.record(SagaEntry{Saga: id, Event: SagaCompleted}))
+}
+
+// compensate sends every compensation in the reverse of the order the
+// steps were enlisted
+func (s *SagaCoordinator) compensate(id string) error {
+	finished, err := s.finish(id)
+	if err != nil {
+		return err
+	}
+	for idx := len(finished.steps) - 1; idx >= 0; idx-- {
+		if step := finished.steps[idx]; step.compensation != nil {
+			err = firstError(err, s.send(id, step.compensation, step.message))
+		}
+	}
+	return firstError(err, s.record(SagaEntry{Saga: id, Event: SagaCompensated}))
+}
+
+func (s *SagaCoordinator) send(id string, producer Producer, message Message) error {
+	var body interface{}
+	if message != nil {
+		body = message.Body()
+	}
+	sent := withBody(message, body)
+	exchange := NewExchange()
+	(*sent.Headers())[SagaIdHeader] = id
+	exchange.Out(sent)
+	exchange.rotate()
+	exchange.Properties()[SagaIdProperty] = id
+	producer.Process(exchange)
+	return exchange.Error()
+}
+
+func (s *SagaCoordinator) record(entry SagaEntry) error {
+	if s.journal == nil {
+		return nil
+	}
+	return s.journal.Append(entry)
+}
+
+// recover compensates the sagas in the journal that were not finished, the
+// first time it is called, resolving their endpoints with the components
+func (s *SagaCoordinator) recover(components componentLookup) error {
+	s.lock.Lock()
+	if s.recovered || s.journal == nil {
+		s.lock.Unlock()
+		return nil
+	}
+	s.recovered = true
+	s.lock.Unlock()
+
+	entries, err := s.journal.Load()
+	if err != nil {
+		return err
+	}
+	cache := newProducerCache(components)
+	cache.Start()
+	defer cache.Close()
+	defer cache.Stop()
+
+	unfinished := make(map[string]*saga)
+	order := make([]string, 0)
+	for _, entry := range entries {
+		switch entry.Event {
+		case SagaBegun:
+			unfinished[entry.Saga] = &saga{}
+			order = append(order, entry.Saga)
+		case SagaEnlisted:
+			if pending, found := unfinished[entry.Saga]; found {
+				step := sagaStep{message: NewMessage(entry.Body)}
+				if entry.Compensation != "" {
+					step.compensation, err = cache.get(entry.Compensation)
+					if err != nil {
+						return err
+					}
+				}
+				pending.steps = append(pending.steps, step)
+			}
+		case SagaCompleted, SagaCompensated:
+			delete(unfinished, entry.Saga)
+		}
+	}
+
+	for _, id := range order {
+		if pending, found := unfinished[id]; found {
+			s.lock.Lock()
+			s.sagas[id] = pending
+			s.lock.Unlock()
+			err = firstError(err, s.compensate(id))
+		}
+	}
+	return err
+}
+
+func firstError(err error, next error) error {
+	if err != nil {
+		return err
+	}
+	return next
+}
+
+// sagaBlock is the block opened by RouteConfiguration.Saga. An exchange
+// that is not already part of a saga starts one that is completed or
+// compensated when the exchange leaves the block. An exchange that is
+// already part of a saga joins it and leaves finishing it to the block
+// that started it.
+type sagaBlock struct {
+	options    SagaOptions
+	components componentLookup
+	step       sagaStep
+	processors pipeline
+}
+
+func (s *sagaBlock) add(processor Processor) {
+	s.processors = append(s.processors, processor)
+}
+
+func (s *sagaBlock) Process(exchange Exchange) {
+	coordinator := s.options.Coordinator
+	id, joined := exchange.Properties()[SagaIdProperty].(string)
+	if joined {
+		if started, ok := exchange.Properties()[sagaCoordinatorProperty].(*SagaCoordinator); ok {
+			coordinator = started
+		}
+	} else {
+		var err error
+		if id, err = coordinator.begin(s.options.Timeout); err != nil {
+			exchange.SetError(err)
+			return
+		}
+		exchange.Properties()[SagaIdProperty] = id
+		exchange.Properties()[sagaCoordinatorProperty] = coordinator
+	}
+
+	if s.step.compensation != nil || s.step.completion != nil {
+		step := s.step
+		step.message = CopyMessage(exchange.In())
+		if err := coordinator.enlist(id, step); err != nil {
+			exchange.SetError(err)
+		}
+	}
+	if exchange.Error() == nil {
+		s.processors.Process(exchange)
+	}
+	if joined {
+		return
+	}
+
+	if exchange.Error() != nil {
+		// todo: log compensation errors (waiting on choosing a log framework)
+		_ = coordinator.compensate(id)
+		return
+	}
+	if err := coordinator.complete(id); err != nil {
+		exchange.SetError(err)
+	}
+}
+
+func (s *sagaBlock) each(do func(service ConsumingService)) {
+	if s.step.compensation != nil {
+		do(s.step.compensation)
+	}
+	if s.step.completion != nil {
+		do(s.step.completion)
+	}
+}
+
+func (s *sagaBlock) Init() {
+	s.processors.Init()
+	s.each(ConsumingService.Init)
+}
+
+func (s *sagaBlock) Start() {
+	s.processors.Start()
+	s.each(ConsumingService.Start)
+	// todo: log recovery errors (waiting on choosing a log framework)
+	_ = s.options.Coordinator.recover(s.components)
+}
+
+func (s *sagaBlock) Stop() {
+	s.each(ConsumingService.Stop)
+	s.processors.Stop()
+}
+
+func (s *sagaBlock) Close() {
+	s.each(ConsumingService.Close)
+	s.processors.Close()
+}
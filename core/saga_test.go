@@ -0,0 +1,158 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sagaRoute(options SagaOptions) RouteCreator {
+	return func(builder RouteBuilder) {
+		builder.FromS("test:order").
+			SagaWith(options).
+			Compensation("test:refund").
+			Completion("test:receipt").
+			ToS("test:payment").
+			Saga().
+			Compensation("test:release").
+			ToS("test:stock").
+			End().
+			ToS("test:shipping").
+			End()
+	}
+}
+
+func TestSagaCompletion(t *testing.T) {
+	context, component := newTestContext()
+	context.Add(sagaRoute(SagaOptions{Coordinator: NewSagaCoordinator(nil)}))
+	context.Start()
+
+	exchange := component.send("test:order", NewTextMessage("order 1"))
+	assert.Nil(t, exchange.Error())
+	assert.Equal(t, 1, component.count("test:receipt"))
+	assert.Equal(t, "order 1", component.received["test:receipt"][0].Body())
+	assert.Equal(t, exchange.Properties()[SagaIdProperty], (*component.received["test:receipt"][0].Headers())[SagaIdHeader])
+	assert.Equal(t, 0, component.count("test:refund"))
+	assert.Equal(t, 0, component.count("test:release"))
+}
+
+func TestSagaCompensation(t *testing.T) {
+	context, component := newTestContext()
+	compensated := make([]string, 0)
+	component.handle("test:shipping", func(exchange Exchange) {
+		exchange.SetError(errors.New("no courier"))
+	})
+	component.handle("test:release", func(exchange Exchange) {
+		compensated = append(compensated, "release")
+	})
+	component.handle("test:refund", func(exchange Exchange) {
+		compensated = append(compensated, "refund")
+	})
+	context.Add(sagaRoute(SagaOptions{Coordinator: NewSagaCoordinator(nil)}))
+	context.Start()
+
+	exchange := component.send("test:order", NewTextMessage("order 1"))
+	assert.NotNil(t, exchange.Error())
+	assert.Equal(t, []string{"release", "refund"}, compensated)
+	assert.Equal(t, 0, component.count("test:receipt"))
+}
+
+func TestSagaTimeout(t *testing.T) {
+	context, component := newTestContext()
+	component.handle("test:shipping", func(exchange Exchange) {
+		time.Sleep(50 * time.Millisecond)
+	})
+	context.Add(sagaRoute(SagaOptions{Coordinator: NewSagaCoordinator(nil), Timeout: 10 * time.Millisecond}))
+	context.Start()
+
+	exchange := component.send("test:order", NewTextMessage("order 1"))
+	assert.IsType(t, SagaNotActive{}, exchange.Error())
+	assert.Equal(t, 1, component.count("test:refund"))
+	assert.Equal(t, 1, component.count("test:release"))
+	assert.Equal(t, 0, component.count("test:receipt"))
+}
+
+func TestSagaJournalRecovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "saga")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal")
+
+	// a saga that was left unfinished before a restart
+	file, err := os.Create(path)
+	assert.Nil(t, err)
+	encoder := json.NewEncoder(file)
+	encoder.Encode(SagaEntry{Saga: "crashed", Event: SagaBegun})
+	encoder.Encode(SagaEntry{Saga: "crashed", Event: SagaEnlisted, Compensation: "test:refund", Body: "order 0"})
+	encoder.Encode(SagaEntry{Saga: "finished", Event: SagaBegun})
+	encoder.Encode(SagaEntry{Saga: "finished", Event: SagaEnlisted, Compensation: "test:refund", Body: "order -1"})
+	encoder.Encode(SagaEntry{Saga: "finished", Event: SagaCompleted})
+	file.Close()
+
+	journal := NewFileSagaJournal(path)
+	context, component := newTestContext()
+	context.Add(sagaRoute(SagaOptions{Coordinator: NewSagaCoordinator(journal)}))
+	context.Start()
+
+	assert.Equal(t, 1, component.count("test:refund"))
+	assert.Equal(t, "order 0", component.received["test:refund"][0].Body())
+
+	component.send("test:order", NewTextMessage("order 1"))
+	entries, err := journal.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, SagaCompensated, entries[5].Event)
+	assert.Equal(t, SagaCompleted, entries[len(entries)-1].Event)
+}
+
+func TestSagaJournalCompaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "saga")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	journal := NewFileSagaJournalWithCompaction(filepath.Join(dir, "journal"), 2)
+
+	for _, entry := range []SagaEntry{
+		{Saga: "first", Event: SagaBegun},
+		{Saga: "running", Event: SagaBegun},
+		{Saga: "first", Event: SagaEnlisted, Compensation: "test:refund", Body: "order 1"},
+		{Saga: "running", Event: SagaEnlisted, Compensation: "test:refund", Body: "order 2"},
+		{Saga: "first", Event: SagaCompleted},
+		{Saga: "second", Event: SagaBegun},
+	} {
+		assert.Nil(t, journal.Append(entry))
+	}
+	// nothing is removed until the second saga finishes
+	entries, err := journal.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, 6, len(entries))
+
+	assert.Nil(t, journal.Append(SagaEntry{Saga: "second", Event: SagaCompensated}))
+	entries, err = journal.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, []SagaEntry{
+		{Saga: "running", Event: SagaBegun},
+		{Saga: "running", Event: SagaEnlisted, Compensation: "test:refund", Body: "order 2"},
+	}, entries)
+
+	// the journal keeps appending after it was compacted
+	assert.Nil(t, journal.Append(SagaEntry{Saga: "running", Event: SagaCompleted}))
+	entries, err = journal.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, []string{"journal"}, dirNames(t, dir))
+}
+
+func dirNames(t *testing.T, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names
+}
@@ -0,0 +1,184 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// SagaEvent is what happened to a saga in a SagaEntry.
+type SagaEvent string
+
+const (
+	SagaBegun       SagaEvent = "begun"
+	SagaEnlisted    SagaEvent = "enlisted"
+	SagaCompleted   SagaEvent = "completed"
+	SagaCompensated SagaEvent = "compensated"
+)
+
+// A SagaEntry is a single event recorded in a SagaJournal. An enlisted
+// entry has the endpoints and the body of the message for the step.
+type SagaEntry struct {
+	Saga         string      `json:"saga"`
+	Event        SagaEvent   `json:"event"`
+	Compensation string      `json:"compensation,omitempty"`
+	Completion   string      `json:"completion,omitempty"`
+	Body         interface{} `json:"body,omitempty"`
+}
+
+// A SagaJournal records the events of a SagaCoordinator so that it can
+// compensate the sagas that were not finished before a restart.
+type SagaJournal interface {
+	// Append the entry to the journal.
+	Append(entry SagaEntry) error
+
+	// Load every entry in the order they were appended.
+	Load() ([]SagaEntry, error)
+}
+
+// DefaultSagaJournalCompaction is the number of sagas that finish between
+// each compaction of a journal created by NewFileSagaJournal.
+const DefaultSagaJournalCompaction = 100
+
+// NewFileSagaJournal creates a SagaJournal that appends each entry to the
+// file as a line of JSON. Bodies are restored from the file as the types
+// encoding/json decodes them to, so string bodies work best. The entries of
+// finished sagas are removed from the file each time another
+// DefaultSagaJournalCompaction sagas have finished.
+func NewFileSagaJournal(path string) SagaJournal {
+	return NewFileSagaJournalWithCompaction(path, DefaultSagaJournalCompaction)
+}
+
+// NewFileSagaJournalWithCompaction creates a SagaJournal like
+// NewFileSagaJournal that removes the entries of finished sagas from the
+// file each time the given number of sagas have finished.
+func NewFileSagaJournalWithCompaction(path string, compactAfter int) SagaJournal {
+	if compactAfter <= 0 {
+		compactAfter = DefaultSagaJournalCompaction
+	}
+	return &fileSagaJournal{
+		path:         path,
+		compactAfter: compactAfter,
+	}
+}
+
+type fileSagaJournal struct {
+	lock sync.Mutex
+	path string
+
+	// finished counts the sagas that finished since the last compaction
+	compactAfter int
+	finished     int
+}
+
+func (f *fileSagaJournal) Append(entry SagaEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if entry.Event == SagaCompleted || entry.Event == SagaCompensated {
+		f.finished++
+		if f.finished >= f.compactAfter {
+			f.finished = 0
+			return f.compact()
+		}
+	}
+	return nil
+}
+
+func (f *fileSagaJournal) Load() ([]SagaEntry, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	entries, _, err := f.read()
+	return entries, err
+}
+
+// read every entry of the file along with the line it was read from. The
+// lock must be held.
+func (f *fileSagaJournal) read() ([]SagaEntry, [][]byte, error) {
+	entries := make([]SagaEntry, 0)
+	lines := make([][]byte, 0)
+	file, err := os.Open(f.path)
+	if os.IsNotExist(err) {
+		return entries, lines, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		entry := SagaEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, nil, err
+		}
+		entries = append(entries, entry)
+		lines = append(lines, append([]byte(nil), scanner.Bytes()...))
+	}
+	return entries, lines, scanner.Err()
+}
+
+// compact rewrites the file with only the entries of the sagas that have
+// not finished. The new file is written next to the journal and renamed
+// over it so that a crash leaves either the old or the new journal. The
+// lock must be held.
+func (f *fileSagaJournal) compact() error {
+	entries, lines, err := f.read()
+	if err != nil {
+		return err
+	}
+	finished := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Event == SagaCompleted || entry.Event == SagaCompensated {
+			finished[entry.Saga] = true
+		}
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(f.path), "."+filepath.Base(f.path)+".")
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(temp)
+	for idx, entry := range entries {
+		if finished[entry.Saga] {
+			continue
+		}
+		if _, err = writer.Write(append(lines[idx], '\n')); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), f.path)
+	}
+	if err != nil {
+		_ = os.Remove(temp.Name())
+	}
+	return err
+}
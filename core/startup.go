@@ -0,0 +1,118 @@
+package core
+
+// startupOrder sorts the routes into the order they are started in. Routes
+// with a StartupOrder come first in ascending order, followed by the other
+// routes in the order they were added, except that a route consuming from
+// an endpoint is always started before the routes producing to it so that,
+// for example, the consumer of a direct endpoint is registered before any
+// exchange is sent to it. Routes that depend on each other in a cycle are
+// started in the order of their StartupOrder once the routes the cycle
+// depends on have started.
+func startupOrder(routes []Route) []Route {
+	infos := make([]RouteInfo, len(routes))
+	consumers := make(map[string][]int)
+	for idx, route := range routes {
+		infos[idx] = route.Info()
+		for _, uri := range infos[idx].Consumers {
+			key := endpointKey(uri)
+			consumers[key] = append(consumers[key], idx)
+		}
+	}
+
+	// the routes that each route produces to
+	produces := make([][]int, len(routes))
+	for idx, info := range infos {
+		for _, uri := range info.Producers {
+			for _, consumer := range consumers[endpointKey(uri)] {
+				if consumer != idx {
+					produces[idx] = append(produces[idx], consumer)
+				}
+			}
+		}
+	}
+
+	// the routes that have to be started before each route. The routes of
+	// a cycle share the dependencies outside of the cycle and do not wait
+	// on each other.
+	reaches := make([][]bool, len(routes))
+	for idx := range routes {
+		reaches[idx] = reachable(produces, idx)
+	}
+	dependencies := make([][]int, len(routes))
+	for idx := range routes {
+		for member := range routes {
+			if member != idx && !(reaches[idx][member] && reaches[member][idx]) {
+				continue
+			}
+			for _, consumer := range produces[member] {
+				if !reaches[consumer][idx] {
+					dependencies[idx] = append(dependencies[idx], consumer)
+				}
+			}
+		}
+	}
+
+	before := func(a, b int) bool {
+		orderA, orderB := infos[a].StartupOrder, infos[b].StartupOrder
+		switch {
+		case orderA != 0 && orderB != 0 && orderA != orderB:
+			return orderA < orderB
+		case orderA != 0 && orderB == 0:
+			return true
+		case orderA == 0 && orderB != 0:
+			return false
+		}
+		return a < b
+	}
+
+	started := make([]bool, len(routes))
+	ready := func(idx int) bool {
+		for _, dependency := range dependencies[idx] {
+			if !started[dependency] {
+				return false
+			}
+		}
+		return true
+	}
+
+	ordered := make([]Route, 0, len(routes))
+	for len(ordered) < len(routes) {
+		next := -1
+		for idx := range routes {
+			if !started[idx] && ready(idx) && (next < 0 || before(idx, next)) {
+				next = idx
+			}
+		}
+		started[next] = true
+		ordered = append(ordered, routes[next])
+	}
+	return ordered
+}
+
+// reachable reports which routes can be reached from the route by
+// following the edges
+func reachable(edges [][]int, from int) []bool {
+	reached := make([]bool, len(edges))
+	pending := []int{from}
+	for len(pending) > 0 {
+		idx := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		for _, next := range edges[idx] {
+			if !reached[next] {
+				reached[next] = true
+				pending = append(pending, next)
+			}
+		}
+	}
+	return reached
+}
+
+// endpointKey identifies an endpoint by its prefix and path so that the
+// same endpoint with different options is matched
+func endpointKey(uri string) string {
+	prefix, path, _, _ := Parse(uri)
+	if prefix == "" {
+		return uri
+	}
+	return prefix + ":" + path
+}
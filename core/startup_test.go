@@ -0,0 +1,82 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func routeIds(routes []Route) []string {
+	ids := make([]string, 0, len(routes))
+	for _, route := range routes {
+		ids = append(ids, route.Id())
+	}
+	return ids
+}
+
+func routesOf(c Context) []Route {
+	return c.(*context).snapshot()
+}
+
+func TestStartupOrder(t *testing.T) {
+	context, _ := newTestContext()
+	assert.Nil(t, context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:a").RouteID("a").ToS("test:b")
+		builder.FromS("test:b").RouteID("b").ToS("test:c?option=true")
+		builder.FromS("test:c").RouteID("c").ToS("test:out")
+		builder.FromS("test:d").RouteID("d").StartupOrder(2).ToS("test:out")
+		builder.FromS("test:e").RouteID("e").StartupOrder(1).ToS("test:out")
+	}))
+
+	assert.Equal(t, []string{"e", "d", "c", "b", "a"}, routeIds(startupOrder(routesOf(context))))
+}
+
+func TestStartupOrderDependencyWins(t *testing.T) {
+	context, _ := newTestContext()
+	assert.Nil(t, context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:a").RouteID("a").StartupOrder(1).ToS("test:b")
+		builder.FromS("test:b").RouteID("b").StartupOrder(2).ToS("test:a")
+		builder.FromS("test:c").RouteID("c").StartupOrder(3).ToS("test:d")
+		builder.FromS("test:d").RouteID("d").ToS("test:out")
+	}))
+
+	// d has to start before c even though it has no order of its own,
+	// while a and b depend on each other so their order decides
+	assert.Equal(t, []string{"a", "b", "d", "c"}, routeIds(startupOrder(routesOf(context))))
+}
+
+func TestStartupOrderBreaksCycles(t *testing.T) {
+	context, _ := newTestContext()
+	assert.Nil(t, context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:z").RouteID("z").StartupOrder(1).ToS("test:x")
+		builder.FromS("test:x").RouteID("x").StartupOrder(3).ToS("test:y")
+		builder.FromS("test:y").RouteID("y").StartupOrder(2).ToS("test:x").ToS("test:w")
+		builder.FromS("test:w").RouteID("w").ToS("test:out")
+	}))
+
+	// the cycle of x and y starts in their order once w, which y produces
+	// to, has started and before z, which produces to x
+	assert.Equal(t, []string{"w", "y", "x", "z"}, routeIds(startupOrder(routesOf(context))))
+}
+
+func TestAutoStartup(t *testing.T) {
+	context, component := newTestContext()
+	assert.Nil(t, context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:in").RouteID("manual").AutoStartup(false).ToS("test:out")
+	}))
+	context.Start()
+
+	info, _ := context.Route("manual")
+	assert.False(t, info.AutoStartup)
+	assert.Equal(t, RouteInitialized, info.Status)
+	assert.Nil(t, component.send("test:in", NewTextMessage("hello")))
+
+	assert.Nil(t, context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:late").RouteID("late").AutoStartup(false).ToS("test:out")
+	}))
+	assert.Equal(t, RouteInitialized, routeStatus(context, "late"))
+
+	assert.Nil(t, context.StartRoute("manual"))
+	assert.NotNil(t, component.send("test:in", NewTextMessage("hello")))
+	assert.Equal(t, 1, component.count("test:out"))
+}
@@ -0,0 +1,150 @@
+package core
+
+import "sync"
+
+// testComponent is a minimal component for exercising routes inside of
+// the core package without importing the bundled components. Consumers
+// are triggered with send and producers record what they were given and
+// then run the function registered for the endpoint with handle, if any.
+type testComponent struct {
+	BaseComponent
+	lock       sync.Mutex
+	initiators map[string]Initiator
+	handlers   map[string]ProcessingFunction
+	received   map[string][]Message
+	states     map[string]string
+	refused    map[string]error
+}
+
+func newTestContext() (Context, *testComponent) {
+	context := Create()
+	return context, registerTestComponent(context, "test")
+}
+
+// registerTestComponent registers another testComponent with the prefix
+func registerTestComponent(context Context, prefix string) *testComponent {
+	component := &testComponent{
+		initiators: make(map[string]Initiator),
+		handlers:   make(map[string]ProcessingFunction),
+		received:   make(map[string][]Message),
+		states:     make(map[string]string),
+		refused:    make(map[string]error),
+	}
+	context.Register(func(context Context) (Component, error) {
+		component.SetPrefix(prefix)
+		component.SetContext(context)
+		return component, nil
+	})
+	return component
+}
+
+// send the message to the route consuming from the path, returning nil if
+// no started route consumes from it
+func (t *testComponent) send(path string, message Message) Exchange {
+	t.lock.Lock()
+	initiator := t.initiators[path]
+	t.lock.Unlock()
+	if initiator == nil {
+		return nil
+	}
+	return initiator.Exchange(message)
+}
+
+func (t *testComponent) handle(path string, handler ProcessingFunction) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.handlers[path] = handler
+}
+
+// refuse makes consumers of the path fail to start with the error until
+// it is called again with nil
+func (t *testComponent) refuse(path string, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.refused[path] = err
+}
+
+func (t *testComponent) state(path string) string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.states[path]
+}
+
+func (t *testComponent) count(path string) int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return len(t.received[path])
+}
+
+func (t *testComponent) CreateEndpoint(path string, options map[string]string) Endpoint {
+	return &testEndpoint{
+		name:      path,
+		component: t,
+	}
+}
+
+type testEndpoint struct {
+	name      string
+	component *testComponent
+}
+
+func (t *testEndpoint) CreateConsumer() (Consumer, error) {
+	return &testConsumer{endpoint: t}, nil
+}
+
+func (t *testEndpoint) CreateProducer() (Producer, error) {
+	return &testProducer{endpoint: t}, nil
+}
+
+type testConsumer struct {
+	endpoint *testEndpoint
+}
+
+func (t *testConsumer) Init()  {}
+func (t *testConsumer) Close() {}
+
+func (t *testConsumer) Stop() {
+	t.endpoint.component.lock.Lock()
+	defer t.endpoint.component.lock.Unlock()
+	delete(t.endpoint.component.initiators, t.endpoint.name)
+}
+
+func (t *testConsumer) Start(initiator Initiator) {
+	_ = t.TryStart(initiator)
+}
+
+func (t *testConsumer) TryStart(initiator Initiator) error {
+	t.endpoint.component.lock.Lock()
+	defer t.endpoint.component.lock.Unlock()
+	if err := t.endpoint.component.refused[t.endpoint.name]; err != nil {
+		return err
+	}
+	t.endpoint.component.initiators[t.endpoint.name] = initiator
+	return nil
+}
+
+type testProducer struct {
+	endpoint *testEndpoint
+}
+
+func (t *testProducer) Init()  { t.transition("initialized") }
+func (t *testProducer) Start() { t.transition("started") }
+func (t *testProducer) Stop()  { t.transition("stopped") }
+func (t *testProducer) Close() { t.transition("closed") }
+
+func (t *testProducer) transition(state string) {
+	t.endpoint.component.lock.Lock()
+	defer t.endpoint.component.lock.Unlock()
+	t.endpoint.component.states[t.endpoint.name] = state
+}
+
+func (t *testProducer) Process(exchange Exchange) {
+	component := t.endpoint.component
+	component.lock.Lock()
+	component.received[t.endpoint.name] = append(component.received[t.endpoint.name], exchange.In())
+	handler := component.handlers[t.endpoint.name]
+	component.lock.Unlock()
+	if handler != nil {
+		handler(exchange)
+	}
+}
@@ -0,0 +1,216 @@
+package core
+
+import "sync"
+
+// TransactionProperty is the exchange property holding the Transaction
+// the exchange is part of while it is inside a Transacted block.
+const TransactionProperty = "Transaction"
+
+// A TransactionResource is committed or rolled back with the Transaction
+// it is enlisted in. A *sql.Tx is a TransactionResource, which is how the
+// sql component takes part in transactions.
+type TransactionResource interface {
+	Commit() error
+	Rollback() error
+}
+
+// A Transaction groups the resources that components enlist while an
+// exchange is processed so that their work is committed together when the
+// exchange succeeds or rolled back when it fails.
+type Transaction interface {
+	// Enlist the resource in the transaction under the key so that a
+	// component can find it again with Resource, such as to reuse one
+	// *sql.Tx for every statement against the same *sql.DB. A nil key
+	// enlists the resource without it being found again.
+	Enlist(key interface{}, resource TransactionResource)
+
+	// Resource returns the resource enlisted with the key or nil.
+	Resource(key interface{}) TransactionResource
+
+	// Commit every enlisted resource in the order they were enlisted.
+	Commit() error
+
+	// Rollback every enlisted resource in the reverse order they were
+	// enlisted.
+	Rollback() error
+}
+
+// A TransactionManager begins the transactions for Transacted blocks.
+type TransactionManager interface {
+	Begin() (Transaction, error)
+}
+
+// TransactionPropagation decides whether a Transacted block joins the
+// transaction the exchange is already part of.
+type TransactionPropagation int
+
+const (
+	// TransactionRequired joins the current transaction if there is one
+	// and begins a new one if there is not.
+	TransactionRequired TransactionPropagation = iota
+
+	// TransactionRequiresNew always begins a new transaction. The steps
+	// after the block go back to the transaction from before the block.
+	TransactionRequiresNew
+)
+
+// A TransactionPolicy configures a Transacted block.
+type TransactionPolicy struct {
+	// Manager begins the transactions. DefaultTransactionManager is used
+	// if it is not set.
+	Manager TransactionManager
+
+	Propagation TransactionPropagation
+}
+
+// DefaultTransactionManager is the TransactionManager used by Transacted
+// blocks whose policy does not set one.
+var DefaultTransactionManager = NewLocalTransactionManager()
+
+// TransactionOf returns the Transaction the exchange is part of or nil if
+// it is not in a Transacted block.
+func TransactionOf(exchange Exchange) Transaction {
+	if transaction, ok := exchange.Properties()[TransactionProperty].(Transaction); ok {
+		return transaction
+	}
+	return nil
+}
+
+// NewLocalTransactionManager creates a TransactionManager for resources
+// that each commit on their own. If a resource fails to commit then the
+// resources after it are rolled back but the resources before it stay
+// committed.
+func NewLocalTransactionManager() TransactionManager {
+	return localTransactionManager{}
+}
+
+type localTransactionManager struct {
+}
+
+func (l localTransactionManager) Begin() (Transaction, error) {
+	return &localTransaction{}, nil
+}
+
+type enlisted struct {
+	key      interface{}
+	resource TransactionResource
+}
+
+type localTransaction struct {
+	lock      sync.Mutex
+	resources []enlisted
+}
+
+func (l *localTransaction) Enlist(key interface{}, resource TransactionResource) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.resources = append(l.resources, enlisted{key: key, resource: resource})
+}
+
+func (l *localTransaction) Resource(key interface{}) TransactionResource {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if key == nil {
+		return nil
+	}
+	for _, e := range l.resources {
+		if e.key == key {
+			return e.resource
+		}
+	}
+	return nil
+}
+
+// take the resources so that the transaction is only finished once
+func (l *localTransaction) take() []enlisted {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	resources := l.resources
+	l.resources = nil
+	return resources
+}
+
+func (l *localTransaction) Commit() error {
+	resources := l.take()
+	for idx, e := range resources {
+		if err := e.resource.Commit(); err != nil {
+			for remaining := len(resources) - 1; remaining > idx; remaining-- {
+				_ = resources[remaining].resource.Rollback()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *localTransaction) Rollback() error {
+	resources := l.take()
+	var err error
+	for idx := len(resources) - 1; idx >= 0; idx-- {
+		err = firstError(err, resources[idx].resource.Rollback())
+	}
+	return err
+}
+
+// transacted is the block opened by RouteConfiguration.Transacted. The
+// transaction is finished when the exchange completes so that the steps
+// after the block and in the routes it calls can still fail it, but before
+// any of the completion callbacks of the exchange are run.
+type transacted struct {
+	policy     TransactionPolicy
+	processors pipeline
+}
+
+func (t *transacted) add(processor Processor) {
+	t.processors = append(t.processors, processor)
+}
+
+func (t *transacted) Process(exchange Exchange) {
+	current := TransactionOf(exchange)
+	if current != nil && t.policy.Propagation == TransactionRequired {
+		t.processors.Process(exchange)
+		return
+	}
+
+	transaction, err := t.policy.Manager.Begin()
+	if err != nil {
+		exchange.SetError(err)
+		return
+	}
+	// finish the transaction before the completion callbacks run so that
+	// they see a failed commit as a failed exchange
+	exchange.addBeforeCompletion(func(exchange Exchange, err error) {
+		if err != nil {
+			// todo: log rollback errors (waiting on choosing a log framework)
+			_ = transaction.Rollback()
+			return
+		}
+		if err := transaction.Commit(); err != nil {
+			exchange.SetError(err)
+		}
+	})
+
+	exchange.Properties()[TransactionProperty] = transaction
+	t.processors.Process(exchange)
+	if current != nil {
+		exchange.Properties()[TransactionProperty] = current
+	} else {
+		delete(exchange.Properties(), TransactionProperty)
+	}
+}
+
+func (t *transacted) Init() {
+	t.processors.Init()
+}
+
+func (t *transacted) Start() {
+	t.processors.Start()
+}
+
+func (t *transacted) Stop() {
+	t.processors.Stop()
+}
+
+func (t *transacted) Close() {
+	t.processors.Close()
+}
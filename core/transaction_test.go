@@ -0,0 +1,160 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testResource struct {
+	name    string
+	log     *[]string
+	failing bool
+}
+
+func (t *testResource) Commit() error {
+	*t.log = append(*t.log, "commit "+t.name)
+	if t.failing {
+		return errors.New("cannot commit " + t.name)
+	}
+	return nil
+}
+
+func (t *testResource) Rollback() error {
+	*t.log = append(*t.log, "rollback "+t.name)
+	return nil
+}
+
+func enlistIn(log *[]string, name string, failing bool) ProcessingFunction {
+	return func(exchange Exchange) {
+		TransactionOf(exchange).Enlist(name, &testResource{name: name, log: log, failing: failing})
+	}
+}
+
+func TestTransactedCommit(t *testing.T) {
+	context, component := newTestContext()
+	log := make([]string, 0)
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:in").
+			Transacted(TransactionPolicy{}).
+			ProcessFunction(enlistIn(&log, "a", false)).
+			ProcessFunction(enlistIn(&log, "b", false)).
+			End().
+			ProcessFunction(func(exchange Exchange) {
+				assert.Nil(t, TransactionOf(exchange))
+				log = append(log, "after")
+			})
+	})
+	context.Start()
+
+	exchange := component.send("test:in", NewTextMessage("hello"))
+	assert.Nil(t, exchange.Error())
+	assert.Equal(t, []string{"after", "commit a", "commit b"}, log)
+}
+
+func TestTransactedRollback(t *testing.T) {
+	context, component := newTestContext()
+	log := make([]string, 0)
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:in").
+			Transacted(TransactionPolicy{}).
+			ProcessFunction(enlistIn(&log, "a", false)).
+			ProcessFunction(enlistIn(&log, "b", false)).
+			End().
+			ProcessFunction(func(exchange Exchange) {
+				exchange.SetError(errors.New("failed after the block"))
+			})
+	})
+	context.Start()
+
+	exchange := component.send("test:in", NewTextMessage("hello"))
+	assert.EqualError(t, exchange.Error(), "failed after the block")
+	assert.Equal(t, []string{"rollback b", "rollback a"}, log)
+}
+
+func TestTransactedCommitFailure(t *testing.T) {
+	context, component := newTestContext()
+	log := make([]string, 0)
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:in").
+			Transacted(TransactionPolicy{}).
+			ProcessFunction(enlistIn(&log, "a", false)).
+			ProcessFunction(enlistIn(&log, "b", true)).
+			ProcessFunction(enlistIn(&log, "c", false)).
+			End()
+	})
+	context.Start()
+
+	exchange := component.send("test:in", NewTextMessage("hello"))
+	assert.EqualError(t, exchange.Error(), "cannot commit b")
+	assert.Equal(t, []string{"commit a", "commit b", "rollback c"}, log)
+}
+
+func TestTransactedPropagation(t *testing.T) {
+	context, component := newTestContext()
+	transactions := make([]Transaction, 0)
+	record := func(exchange Exchange) {
+		transactions = append(transactions, TransactionOf(exchange))
+	}
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:in").
+			Transacted(TransactionPolicy{}).
+			ProcessFunction(record).
+			Transacted(TransactionPolicy{}).
+			ProcessFunction(record).
+			End().
+			Transacted(TransactionPolicy{Propagation: TransactionRequiresNew}).
+			ProcessFunction(record).
+			End().
+			ProcessFunction(record).
+			End()
+	})
+	context.Start()
+
+	exchange := component.send("test:in", NewTextMessage("hello"))
+	assert.Nil(t, exchange.Error())
+	assert.Equal(t, 4, len(transactions))
+	assert.True(t, transactions[0] == transactions[1])
+	assert.False(t, transactions[0] == transactions[2])
+	assert.True(t, transactions[0] == transactions[3])
+}
+
+func TestTransactionResource(t *testing.T) {
+	transaction, err := NewLocalTransactionManager().Begin()
+	assert.Nil(t, err)
+	log := make([]string, 0)
+	resource := &testResource{name: "a", log: &log}
+	transaction.Enlist("a", resource)
+	transaction.Enlist(nil, &testResource{name: "b", log: &log})
+	assert.True(t, transaction.Resource("a") == resource)
+	assert.Nil(t, transaction.Resource("b"))
+	assert.Nil(t, transaction.Resource(nil))
+
+	assert.Nil(t, transaction.Commit())
+	assert.Nil(t, transaction.Rollback())
+	assert.Equal(t, []string{"commit a", "commit b"}, log)
+}
+
+func TestTransactedCommitFailureBeforeCompletion(t *testing.T) {
+	context, component := newTestContext()
+	log := make([]string, 0)
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:in").
+			OnCompletionWhen(CompleteOnSuccess).
+			ToS("test:succeeded").
+			End().
+			OnCompletionWhen(CompleteOnFailure).
+			ToS("test:failed").
+			End().
+			Transacted(TransactionPolicy{}).
+			ProcessFunction(enlistIn(&log, "a", true)).
+			End()
+	})
+	context.Start()
+
+	exchange := component.send("test:in", NewTextMessage("hello"))
+	assert.EqualError(t, exchange.Error(), "cannot commit a")
+	assert.Equal(t, 0, component.count("test:succeeded"))
+	assert.Equal(t, 1, component.count("test:failed"))
+}
@@ -0,0 +1,118 @@
+package core
+
+import "sync"
+
+const (
+	// DefaultWireTapWorkers is the number of goroutines that send tapped
+	// exchanges when WireTapOptions does not set Workers.
+	DefaultWireTapWorkers = 4
+
+	// DefaultWireTapQueue is the number of tapped exchanges that can wait
+	// for a worker when WireTapOptions does not set Queue.
+	DefaultWireTapQueue = 1000
+)
+
+// WireTapOptions configure how a WireTap sends its copies.
+type WireTapOptions struct {
+	// Workers is the number of goroutines sending tapped exchanges.
+	Workers int
+
+	// Queue is the number of tapped exchanges that can wait for a
+	// worker. When the queue is full new copies are dropped so that
+	// the route is never slowed down by the tap.
+	Queue int
+
+	// Transform is run against the copy before it is queued so that the
+	// body or headers sent to the tap can differ from the route's. The
+	// out message it sets becomes the in message of the tapped copy.
+	Transform ProcessingFunction
+}
+
+// wireTap sends a copy of each exchange to a producer from a pool of
+// goroutines. The original exchange continues along the route straight
+// away and is not changed by the tap.
+type wireTap struct {
+	producer Producer
+	options  WireTapOptions
+
+	lock    sync.RWMutex
+	queue   chan Exchange
+	workers sync.WaitGroup
+}
+
+func newWireTap(producer Producer, options WireTapOptions) *wireTap {
+	if options.Workers <= 0 {
+		options.Workers = DefaultWireTapWorkers
+	}
+	if options.Queue <= 0 {
+		options.Queue = DefaultWireTapQueue
+	}
+	return &wireTap{
+		producer: producer,
+		options:  options,
+	}
+}
+
+func (w *wireTap) Process(exchange Exchange) {
+	tapped := newCopiedExchange(exchange)
+	if w.options.Transform != nil {
+		w.options.Transform(tapped)
+		tapped.rotate()
+	}
+
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	if w.queue == nil {
+		return
+	}
+	select {
+	case w.queue <- tapped:
+	default:
+		// todo: log the dropped copy (waiting on choosing a log framework)
+	}
+}
+
+func (w *wireTap) work(queue chan Exchange) {
+	defer w.workers.Done()
+	for tapped := range queue {
+		w.producer.Process(tapped)
+		tapped.rotate()
+	}
+}
+
+func (w *wireTap) Init() {
+	w.producer.Init()
+}
+
+func (w *wireTap) Start() {
+	w.producer.Start()
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.queue != nil {
+		return
+	}
+	w.queue = make(chan Exchange, w.options.Queue)
+	for idx := 0; idx < w.options.Workers; idx++ {
+		w.workers.Add(1)
+		go w.work(w.queue)
+	}
+}
+
+// Stop stops accepting copies and waits for the queued copies to be sent
+// before stopping the producer.
+func (w *wireTap) Stop() {
+	w.lock.Lock()
+	if w.queue != nil {
+		close(w.queue)
+		w.queue = nil
+	}
+	w.lock.Unlock()
+
+	w.workers.Wait()
+	w.producer.Stop()
+}
+
+func (w *wireTap) Close() {
+	w.producer.Close()
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWireTap(t *testing.T) {
+	context, component := newTestContext()
+
+	release := make(chan struct{})
+	component.handle("test:audit", func(exchange Exchange) {
+		<-release
+		exchange.Out(NewTextMessage("audit reply"))
+	})
+
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").RequestReply().
+			WireTapWith("test:audit", WireTapOptions{
+				Transform: func(exchange Exchange) {
+					message := NewTextMessage("tapped " + exchange.In().Body().(string))
+					(*message.Headers())["tapped"] = true
+					exchange.Out(message)
+				},
+			}).
+			ProcessFunction(func(exchange Exchange) {
+				exchange.Out(NewTextMessage("reply"))
+			})
+	})
+	context.Start()
+
+	// the route replies while the tap is still blocked
+	message := NewTextMessage("hello")
+	exchange := component.send("test:start", message)
+	assert.Equal(t, "reply", exchange.In().Body())
+	_, tapped := (*message.Headers())["tapped"]
+	assert.False(t, tapped)
+
+	close(release)
+	context.Stop()
+
+	assert.Equal(t, 1, component.count("test:audit"))
+	assert.Equal(t, "tapped hello", component.received["test:audit"][0].Body())
+	assert.Equal(t, true, (*component.received["test:audit"][0].Headers())["tapped"])
+}
+
+func TestWireTapDropsWhenFull(t *testing.T) {
+	context, component := newTestContext()
+
+	entered := make(chan struct{}, 10)
+	release := make(chan struct{})
+	component.handle("test:slow", func(exchange Exchange) {
+		entered <- struct{}{}
+		<-release
+	})
+
+	context.Add(func(builder RouteBuilder) {
+		builder.FromS("test:start").WireTapWith("test:slow", WireTapOptions{Workers: 1, Queue: 1})
+	})
+	context.Start()
+
+	// the only worker is busy with the first copy before the rest are sent
+	component.send("test:start", NewTextMessage("0"))
+	<-entered
+	for idx := 1; idx < 10; idx++ {
+		component.send("test:start", NewTextMessage(strconv.Itoa(idx)))
+	}
+
+	close(release)
+	context.Stop()
+
+	// one copy was being sent, one was queued and the rest were dropped
+	assert.Equal(t, 2, component.count("test:slow"))
+	assert.Equal(t, "0", component.received["test:slow"][0].Body())
+	assert.Equal(t, "1", component.received["test:slow"][1].Body())
+}
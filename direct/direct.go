@@ -1,14 +1,43 @@
 package direct
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/guanaco/guancano/core"
 )
 
 const Prefix = "direct"
 
+// FireAndForgetOption is the endpoint option that, when set to "true" on a
+// producing endpoint, discards the reply and any error of the called route
+// instead of returning them to the calling route.
+const FireAndForgetOption = "fireAndForget"
+
+// NoConsumer is the error set on an exchange that was sent to a direct
+// endpoint that no started route consumes from.
+type NoConsumer struct {
+	Endpoint string
+}
+
+func (n NoConsumer) Error() string {
+	return fmt.Sprintf("No consumer is available for the Endpoint %s", n.Endpoint)
+}
+
+// DuplicateConsumer is the error returned when starting a route that
+// consumes from a direct endpoint that another route already consumes from.
+type DuplicateConsumer struct {
+	Endpoint string
+}
+
+func (d DuplicateConsumer) Error() string {
+	return fmt.Sprintf("A consumer is already started for the Endpoint %s", d.Endpoint)
+}
+
 func ComponentCreator(ctx core.Context) (core.Component, error) {
 	component := DirectComponent{
 		directs: make(map[string]core.Initiator),
+		lock:    &sync.RWMutex{},
 	}
 	component.SetPrefix(Prefix)
 	component.SetContext(ctx)
@@ -21,20 +50,29 @@ func ComponentCreator(ctx core.Context) (core.Component, error) {
 type DirectComponent struct {
 	core.BaseComponent
 	directs map[string]core.Initiator
+	lock    *sync.RWMutex
+}
+
+func (d DirectComponent) initiator(name string) core.Initiator {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.directs[name]
 }
 
 func (d DirectComponent) CreateEndpoint(path string, options map[string]string) core.Endpoint {
 	return &directEndpoint{
-		name:      path,
-		component: d,
+		name:          path,
+		component:     d,
+		fireAndForget: options[FireAndForgetOption] == "true",
 	}
 }
 
 // Implementation of the endpoint that maps back to the direct links inside of
 // the DirectComponent
 type directEndpoint struct {
-	name      string
-	component DirectComponent
+	name          string
+	component     DirectComponent
+	fireAndForget bool
 }
 
 func (d *directEndpoint) CreateConsumer() (core.Consumer, error) {
@@ -44,7 +82,8 @@ func (d *directEndpoint) CreateConsumer() (core.Consumer, error) {
 }
 
 type directConsumer struct {
-	endpoint *directEndpoint
+	endpoint  *directEndpoint
+	initiator core.Initiator
 }
 
 func (d *directConsumer) Name() string {
@@ -52,7 +91,20 @@ func (d *directConsumer) Name() string {
 }
 
 func (d *directConsumer) Start(initiator core.Initiator) {
+	_ = d.TryStart(initiator)
+}
+
+// TryStart links the route to the endpoint name or returns
+// DuplicateConsumer if another route already consumes from it.
+func (d *directConsumer) TryStart(initiator core.Initiator) error {
+	d.endpoint.component.lock.Lock()
+	defer d.endpoint.component.lock.Unlock()
+	if _, found := d.endpoint.component.directs[d.endpoint.name]; found {
+		return DuplicateConsumer{Endpoint: d.endpoint.name}
+	}
 	d.endpoint.component.directs[d.endpoint.name] = initiator
+	d.initiator = initiator
+	return nil
 }
 
 func (d *directConsumer) Init() {
@@ -60,7 +112,12 @@ func (d *directConsumer) Init() {
 }
 
 func (d *directConsumer) Stop() {
-	delete(d.endpoint.component.directs, d.endpoint.name)
+	d.endpoint.component.lock.Lock()
+	defer d.endpoint.component.lock.Unlock()
+	// only remove the link if it is still the one this consumer made
+	if d.endpoint.component.directs[d.endpoint.name] == d.initiator {
+		delete(d.endpoint.component.directs, d.endpoint.name)
+	}
 }
 
 func (d *directConsumer) Close() {
@@ -97,6 +154,24 @@ func (d *directProducer) Close() {
 
 }
 
+// Process hands the exchange to the route consuming from the direct endpoint
+// and waits for it to finish. The result of the called route becomes the out
+// message of the calling exchange and an error in the called route fails the
+// calling exchange, unless the endpoint is fire and forget. The exchange
+// fails with NoConsumer if no started route consumes from the endpoint.
 func (d *directProducer) Process(exchange core.Exchange) {
-	d.endpoint.component.directs[d.endpoint.name].Exchange(exchange.In())
+	initiator := d.endpoint.component.initiator(d.endpoint.name)
+	if initiator == nil {
+		exchange.SetError(NoConsumer{Endpoint: d.endpoint.name})
+		return
+	}
+	result := initiator.ExchangeWithParent(exchange)
+	if d.endpoint.fireAndForget {
+		return
+	}
+	if result.Error() != nil {
+		exchange.SetError(result.Error())
+		return
+	}
+	exchange.Out(result.In())
 }
@@ -1,9 +1,13 @@
 package direct
 
 import (
+	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/guanaco/guancano/core"
 	"github.com/guanaco/guancano/mock"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -73,3 +77,238 @@ func TestMultiPrefix(t *testing.T) {
 	counts, _ := mocker.ProducerStats("mock:aggregate")
 	assert.Equal(t, 2, counts)
 }
+
+func TestDirectChildExchange(t *testing.T) {
+
+	context := core.Create()
+	context.Register(ComponentCreator)
+	component := context.Register(mock.ComponentCreator)
+	mocker := component.(mock.MockComponent)
+
+	var parent, child core.Exchange
+
+	context.Add(func(builder core.RouteBuilder) {
+		builder.FromS("mock:start").ProcessFunction(func(exchange core.Exchange) {
+			exchange.Properties()["tenant"] = "llama"
+			parent = exchange
+		}).ToS("direct:child")
+		builder.FromS("direct:child").ProcessFunction(func(exchange core.Exchange) {
+			exchange.Properties()["child"] = true
+			child = exchange
+		})
+	})
+
+	context.Start()
+
+	mocker.Send("mock:start", core.NewTextMessage("hello"))
+
+	assert.NotEqual(t, parent.Id(), child.Id())
+	assert.Equal(t, "", parent.ParentId())
+	assert.Equal(t, parent.Id(), child.ParentId())
+	assert.Equal(t, parent.BreadcrumbId(), child.BreadcrumbId())
+	assert.Equal(t, "llama", child.Properties()["tenant"])
+
+	// properties set in the child are scoped to the child
+	_, found := parent.Properties()["child"]
+	assert.False(t, found)
+}
+
+func TestDirectReply(t *testing.T) {
+
+	context := core.Create()
+	context.Register(ComponentCreator)
+	component := context.Register(mock.ComponentCreator)
+	mocker := component.(mock.MockComponent)
+
+	failure := errors.New("sub-route failed")
+
+	context.Add(func(builder core.RouteBuilder) {
+		builder.FromS("mock:start").RequestReply().ToS("direct:upper")
+		builder.FromS("mock:forget").RequestReply().ToS("direct:upper?fireAndForget=true")
+		builder.FromS("mock:fail").RequestReply().ToS("direct:fail").ToS("mock:unreachable")
+		builder.FromS("direct:upper").ProcessFunction(func(exchange core.Exchange) {
+			text := exchange.In().(core.TextMessage).Text()
+			exchange.Out(core.NewTextMessage(strings.ToUpper(text)))
+		})
+		builder.FromS("direct:fail").ProcessFunction(func(exchange core.Exchange) {
+			exchange.SetError(failure)
+		})
+	})
+
+	context.Start()
+
+	mocker.Send("mock:start", core.NewTextMessage("hello"))
+	_, responses := mocker.ConsumerStats("mock:start")
+	assert.Equal(t, 1, len(responses))
+	assert.Equal(t, "HELLO", responses[0].Body())
+
+	mocker.Send("mock:forget", core.NewTextMessage("hello"))
+	_, responses = mocker.ConsumerStats("mock:forget")
+	assert.Equal(t, 1, len(responses))
+	assert.Equal(t, "hello", responses[0].Body())
+
+	mocker.Send("mock:fail", core.NewTextMessage("hello"))
+	invocations, _ := mocker.ProducerStats("mock:unreachable")
+	assert.Equal(t, 0, invocations)
+}
+
+func TestConcurrentDirect(t *testing.T) {
+
+	context := core.Create()
+	context.Register(ComponentCreator)
+	component := context.Register(mock.ComponentCreator)
+	mocker := component.(mock.MockComponent)
+
+	context.Add(func(builder core.RouteBuilder) {
+		builder.FromS("mock:start").RequestReply().ToS("direct:route1").ToS("mock:out")
+		builder.FromS("direct:route1").ToS("direct:route2")
+		builder.FromS("direct:route2").ToS("mock:middle")
+	})
+
+	context.Start()
+
+	senders := 8
+	messages := 50
+	wg := sync.WaitGroup{}
+	for sender := 0; sender < senders; sender++ {
+		wg.Add(1)
+		go func(sender int) {
+			defer wg.Done()
+			for idx := 0; idx < messages; idx++ {
+				mocker.Send("mock:start", core.NewTextMessage(fmt.Sprintf("%d-%d", sender, idx)))
+			}
+		}(sender)
+	}
+	wg.Wait()
+
+	count, _ := mocker.ProducerStats("mock:middle")
+	assert.Equal(t, senders*messages, count)
+	count, _ = mocker.ProducerStats("mock:out")
+	assert.Equal(t, senders*messages, count)
+	count, _ = mocker.ConsumerStats("mock:start")
+	assert.Equal(t, senders*messages, count)
+}
+
+func TestDirectSaga(t *testing.T) {
+
+	context := core.Create()
+	context.Register(ComponentCreator)
+	component := context.Register(mock.ComponentCreator)
+	mocker := component.(mock.MockComponent)
+
+	context.Add(func(builder core.RouteBuilder) {
+		builder.FromS("mock:order").
+			Saga().
+			ToS("direct:payment").
+			ToS("direct:stock").
+			ToS("direct:shipping").
+			End()
+		builder.FromS("direct:payment").Saga().Compensation("mock:refund").ToS("mock:pay").End()
+		builder.FromS("direct:stock").Saga().Compensation("mock:release").ToS("mock:reserve").End()
+		builder.FromS("direct:shipping").ProcessFunction(func(exchange core.Exchange) {
+			exchange.SetError(errors.New("no courier"))
+		})
+	})
+
+	context.Start()
+
+	mocker.Send("mock:order", core.NewTextMessage("order"))
+
+	count, _ := mocker.ProducerStats("mock:refund")
+	assert.Equal(t, 1, count)
+	count, _ = mocker.ProducerStats("mock:release")
+	assert.Equal(t, 1, count)
+}
+
+func TestDirectStartupOrder(t *testing.T) {
+	context := core.Create()
+	context.Register(ComponentCreator)
+	component := context.Register(mock.ComponentCreator)
+	mocker := component.(mock.MockComponent)
+
+	// the producing route is added first but the consuming route has to be
+	// started first for the exchange to be delivered
+	context.Add(func(builder core.RouteBuilder) {
+		builder.FromS("mock:in").ToS("direct:next")
+		builder.FromS("direct:next").ToS("mock:out")
+	})
+	context.Start()
+
+	mocker.Send("mock:in", core.NewTextMessage("hello"))
+	count, _ := mocker.ProducerStats("mock:out")
+	assert.Equal(t, 1, count)
+}
+
+func TestDirectNoConsumer(t *testing.T) {
+	context := core.Create()
+	context.Register(ComponentCreator)
+	component := context.Register(mock.ComponentCreator)
+	mocker := component.(mock.MockComponent)
+
+	var err error
+	context.Add(func(builder core.RouteBuilder) {
+		builder.FromS("mock:in").
+			OnCompletion().
+			ProcessFunction(func(exchange core.Exchange) {
+				err, _ = exchange.Properties()[core.CompletionErrorProperty].(error)
+			}).
+			End().
+			ToS("direct:missing").
+			ToS("mock:out")
+	})
+	context.Start()
+
+	mocker.Send("mock:in", core.NewTextMessage("hello"))
+	assert.Equal(t, NoConsumer{Endpoint: "direct:missing"}, err)
+	count, _ := mocker.ProducerStats("mock:out")
+	assert.Equal(t, 0, count)
+}
+
+func TestDirectDuplicateConsumer(t *testing.T) {
+	context := core.Create()
+	context.Register(ComponentCreator)
+	context.Register(mock.ComponentCreator)
+
+	context.Start()
+	defer context.Stop()
+	assert.Nil(t, context.Add(func(builder core.RouteBuilder) {
+		builder.FromS("direct:owned").RouteID("owner").ToS("mock:owner")
+	}))
+	err := context.Add(func(builder core.RouteBuilder) {
+		builder.FromS("direct:owned").RouteID("intruder").ToS("mock:intruder")
+	})
+	assert.Equal(t, DuplicateConsumer{Endpoint: "direct:owned"}, err)
+	info, _ := context.Route("intruder")
+	assert.Equal(t, core.RouteInitialized, info.Status)
+}
+
+func TestDirectConsumerHandover(t *testing.T) {
+	context := core.Create()
+	context.Register(ComponentCreator)
+	component := context.Register(mock.ComponentCreator)
+	mocker := component.(mock.MockComponent)
+
+	assert.Nil(t, context.Add(func(builder core.RouteBuilder) {
+		builder.FromS("mock:in").RouteID("sender").ToS("direct:owned")
+		builder.FromS("direct:owned").RouteID("owner").ToS("mock:owner")
+		builder.FromS("direct:owned").RouteID("successor").ToS("mock:successor")
+	}))
+
+	// the second consumer is refused without unlinking the first
+	assert.Nil(t, context.StartRoute("sender"))
+	assert.Nil(t, context.StartRoute("owner"))
+	defer context.Stop()
+	assert.Equal(t, DuplicateConsumer{Endpoint: "direct:owned"}, context.StartRoute("successor"))
+	mocker.Send("mock:in", core.NewTextMessage("owned"))
+	count, _ := mocker.ProducerStats("mock:owner")
+	assert.Equal(t, 1, count)
+
+	// once the owner stops another route can consume from the endpoint
+	assert.Nil(t, context.StopRoute("owner"))
+	assert.Nil(t, context.StartRoute("successor"))
+	mocker.Send("mock:in", core.NewTextMessage("handed over"))
+	count, _ = mocker.ProducerStats("mock:owner")
+	assert.Equal(t, 1, count)
+	count, _ = mocker.ProducerStats("mock:successor")
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,327 @@
+package directvm
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/guanaco/guancano/core"
+)
+
+const Prefix = "direct-vm"
+
+const (
+	// FireAndForgetOption is the endpoint option that, when set to "true"
+	// on a producing endpoint, discards the reply and any error of the
+	// called route instead of returning them to the calling route.
+	FireAndForgetOption = "fireAndForget"
+
+	// NoConsumerOption is the endpoint option that overrides the
+	// NoConsumerMode of the component for a single producing endpoint.
+	NoConsumerOption = "noConsumer"
+
+	// TimeoutOption is the endpoint option that overrides how long a
+	// producing endpoint in the Block mode waits for a consumer. The
+	// value is parsed with time.ParseDuration.
+	TimeoutOption = "timeout"
+)
+
+// NoConsumerMode is what a producer does when an exchange is sent to an
+// endpoint that no route in any context is consuming from.
+type NoConsumerMode string
+
+const (
+	// Block waits for a consumer to be started up to the timeout and
+	// fails the exchange if none is started in time.
+	Block NoConsumerMode = "block"
+
+	// Fail fails the exchange immediately.
+	Fail NoConsumerMode = "fail"
+
+	// Drop silently discards the exchange.
+	Drop NoConsumerMode = "drop"
+)
+
+// DefaultTimeout is how long a producer in the Block mode waits for a
+// consumer when no other timeout is configured.
+const DefaultTimeout = 30 * time.Second
+
+// NoConsumer is the error set on an exchange that was sent to an endpoint
+// that has no consumer.
+type NoConsumer struct {
+	Endpoint string
+}
+
+func (n NoConsumer) Error() string {
+	return fmt.Sprintf("No consumer is available for the Endpoint %s", n.Endpoint)
+}
+
+// DuplicateConsumer is the error returned when starting a route that
+// consumes from an endpoint that a route in any context already consumes
+// from.
+type DuplicateConsumer struct {
+	Endpoint string
+}
+
+func (d DuplicateConsumer) Error() string {
+	return fmt.Sprintf("A consumer is already started for the Endpoint %s", d.Endpoint)
+}
+
+// InvalidNoConsumerMode is the error returned when creating a producer for
+// an endpoint whose noConsumer option is not one of the NoConsumerModes.
+type InvalidNoConsumerMode struct {
+	Mode string
+}
+
+func (i InvalidNoConsumerMode) Error() string {
+	return fmt.Sprintf("The no consumer mode %s is not one of block, fail or drop", i.Mode)
+}
+
+// the process wide registry shared by every DirectVMComponent regardless
+// of the context that it was registered with
+var endpoints = &registry{
+	initiators: make(map[string]core.Initiator),
+	waiting:    make(map[string]*waiting),
+}
+
+// ComponentCreator creates a DirectVMComponent that blocks for the
+// DefaultTimeout when there is no consumer.
+func ComponentCreator(ctx core.Context) (core.Component, error) {
+	return ComponentCreatorWithMode(Block, DefaultTimeout)(ctx)
+}
+
+// ComponentCreatorWithMode returns a creator for a DirectVMComponent with
+// the given behavior for when there is no consumer. The timeout is only
+// used by the Block mode.
+func ComponentCreatorWithMode(mode NoConsumerMode, timeout time.Duration) core.ComponentCreator {
+	return func(ctx core.Context) (core.Component, error) {
+		component := DirectVMComponent{
+			mode:    mode,
+			timeout: timeout,
+		}
+		component.SetPrefix(Prefix)
+		component.SetContext(ctx)
+		return component, nil
+	}
+}
+
+// Implementation of a DirectVMComponent. A DirectVMComponent moves messages
+// directly from a named Producer to a named Consumer like a DirectComponent
+// but the names are shared by every Context in the process.
+type DirectVMComponent struct {
+	core.BaseComponent
+	mode    NoConsumerMode
+	timeout time.Duration
+}
+
+func (d DirectVMComponent) CreateEndpoint(path string, options map[string]string) core.Endpoint {
+	endpoint := &directVMEndpoint{
+		name:          path,
+		mode:          d.mode,
+		timeout:       d.timeout,
+		fireAndForget: options[FireAndForgetOption] == "true",
+	}
+	if mode, found := options[NoConsumerOption]; found {
+		endpoint.mode = NoConsumerMode(mode)
+	}
+	if timeout, err := time.ParseDuration(options[TimeoutOption]); err == nil {
+		endpoint.timeout = timeout
+	}
+	return endpoint
+}
+
+type directVMEndpoint struct {
+	name          string
+	mode          NoConsumerMode
+	timeout       time.Duration
+	fireAndForget bool
+}
+
+func (d *directVMEndpoint) CreateConsumer() (core.Consumer, error) {
+	return &directVMConsumer{
+		endpoint: d,
+	}, nil
+}
+
+type directVMConsumer struct {
+	endpoint  *directVMEndpoint
+	initiator core.Initiator
+}
+
+func (d *directVMConsumer) Name() string {
+	return d.endpoint.name
+}
+
+func (d *directVMConsumer) Start(initiator core.Initiator) {
+	_ = d.TryStart(initiator)
+}
+
+// TryStart registers the route for the endpoint name or returns
+// DuplicateConsumer if a route in any context already consumes from it.
+func (d *directVMConsumer) TryStart(initiator core.Initiator) error {
+	if err := endpoints.register(d.endpoint.name, initiator); err != nil {
+		return err
+	}
+	d.initiator = initiator
+	return nil
+}
+
+func (d *directVMConsumer) Init() {
+
+}
+
+func (d *directVMConsumer) Stop() {
+	endpoints.unregister(d.endpoint.name, d.initiator)
+}
+
+func (d *directVMConsumer) Close() {
+
+}
+
+func (d *directVMEndpoint) CreateProducer() (core.Producer, error) {
+	switch d.mode {
+	case Block, Fail, Drop:
+	default:
+		return nil, InvalidNoConsumerMode{Mode: string(d.mode)}
+	}
+	return &directVMProducer{
+		endpoint: d,
+	}, nil
+}
+
+type directVMProducer struct {
+	endpoint *directVMEndpoint
+}
+
+func (d *directVMProducer) Name() string {
+	return d.endpoint.name
+}
+
+func (d *directVMProducer) Init() {
+
+}
+
+func (d *directVMProducer) Start() {
+
+}
+
+func (d *directVMProducer) Stop() {
+
+}
+
+func (d *directVMProducer) Close() {
+
+}
+
+// Process hands the exchange to the route consuming from the endpoint in
+// any context. When there is no consumer the NoConsumerMode of the endpoint
+// decides whether to wait for one, fail the exchange, or drop it.
+func (d *directVMProducer) Process(exchange core.Exchange) {
+	initiator := endpoints.lookup(d.endpoint.name)
+	if initiator == nil && d.endpoint.mode == Block {
+		initiator = endpoints.await(d.endpoint.name, d.endpoint.timeout)
+	}
+	if initiator == nil {
+		if d.endpoint.mode != Drop {
+			exchange.SetError(NoConsumer{Endpoint: d.endpoint.name})
+		}
+		return
+	}
+
+	result := initiator.ExchangeWithParent(exchange)
+	if d.endpoint.fireAndForget {
+		return
+	}
+	if result.Error() != nil {
+		exchange.SetError(result.Error())
+		return
+	}
+	exchange.Out(result.In())
+}
+
+// registry of the initiators for each endpoint name along with the
+// producers waiting for each name to be started
+type registry struct {
+	lock       sync.Mutex
+	initiators map[string]core.Initiator
+	waiting    map[string]*waiting
+}
+
+// waiting is closed when a consumer is started for the name and counts
+// the producers waiting on it so that the last one to time out removes it
+type waiting struct {
+	started   chan struct{}
+	producers int
+}
+
+func (r *registry) register(name string, initiator core.Initiator) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, found := r.initiators[name]; found {
+		return DuplicateConsumer{Endpoint: name}
+	}
+	r.initiators[name] = initiator
+	if waiting, found := r.waiting[name]; found {
+		close(waiting.started)
+		delete(r.waiting, name)
+	}
+	return nil
+}
+
+// unregister the initiator only if it is still the one registered for the
+// name so that stopping one context does not remove another's consumer
+func (r *registry) unregister(name string, initiator core.Initiator) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.initiators[name] == initiator {
+		delete(r.initiators, name)
+	}
+}
+
+func (r *registry) lookup(name string) core.Initiator {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.initiators[name]
+}
+
+func (r *registry) await(name string, timeout time.Duration) core.Initiator {
+	r.lock.Lock()
+	if initiator, found := r.initiators[name]; found {
+		r.lock.Unlock()
+		return initiator
+	}
+	entry, found := r.waiting[name]
+	if !found {
+		entry = &waiting{started: make(chan struct{})}
+		r.waiting[name] = entry
+	}
+	entry.producers++
+	r.lock.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-entry.started:
+		return r.lookup(name)
+	case <-timer.C:
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	entry.producers--
+	if entry.producers == 0 && r.waiting[name] == entry {
+		delete(r.waiting, name)
+	}
+	// a consumer may have been started while the timer fired
+	return r.initiators[name]
+}
+
+// waiters is the number of producers waiting for the name to be started
+func (r *registry) waiters(name string) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if entry, found := r.waiting[name]; found {
+		return entry.producers
+	}
+	return 0
+}
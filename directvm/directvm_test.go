@@ -0,0 +1,167 @@
+package directvm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/guanaco/guancano/core"
+	"github.com/guanaco/guancano/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrossContext(t *testing.T) {
+
+	tenant1 := core.Create()
+	tenant1.Register(ComponentCreator)
+	component := tenant1.Register(mock.ComponentCreator)
+	mocker := component.(mock.MockComponent)
+
+	tenant2 := core.Create()
+	tenant2.Register(ComponentCreator)
+	component = tenant2.Register(mock.ComponentCreator)
+	collector := component.(mock.MockComponent)
+
+	tenant1.Add(func(builder core.RouteBuilder) {
+		builder.FromS("mock:start").RequestReply().ToS("direct-vm:shared")
+	})
+	tenant2.Add(func(builder core.RouteBuilder) {
+		builder.FromS("direct-vm:shared").ProcessFunction(func(exchange core.Exchange) {
+			exchange.Out(core.NewTextMessage("from tenant2"))
+		}).ToS("mock:out")
+	})
+
+	tenant1.Start()
+	tenant2.Start()
+	defer tenant1.Stop()
+	defer tenant2.Stop()
+
+	mocker.Send("mock:start", core.NewTextMessage("hello"))
+
+	count, _ := collector.ProducerStats("mock:out")
+	assert.Equal(t, 1, count)
+	_, responses := mocker.ConsumerStats("mock:start")
+	assert.Equal(t, 1, len(responses))
+	assert.Equal(t, "from tenant2", responses[0].Body())
+}
+
+func TestNoConsumerModes(t *testing.T) {
+
+	context := core.Create()
+	context.RegisterWithPrefix(Prefix, ComponentCreatorWithMode(Fail, 0))
+	component := context.Register(mock.ComponentCreator)
+	mocker := component.(mock.MockComponent)
+
+	context.Add(func(builder core.RouteBuilder) {
+		builder.FromS("mock:fail").ToS("direct-vm:nobody").ToS("mock:after-fail")
+		builder.FromS("mock:drop").ToS("direct-vm:nobody?noConsumer=drop").ToS("mock:after-drop")
+		builder.FromS("mock:block").ToS("direct-vm:nobody?noConsumer=block&timeout=10ms").ToS("mock:after-block")
+	})
+
+	context.Start()
+	defer context.Stop()
+
+	mocker.Send("mock:fail", core.NewTextMessage("hello"))
+	mocker.Send("mock:drop", core.NewTextMessage("hello"))
+	mocker.Send("mock:block", core.NewTextMessage("hello"))
+
+	count, _ := mocker.ProducerStats("mock:after-fail")
+	assert.Equal(t, 0, count)
+	count, _ = mocker.ProducerStats("mock:after-drop")
+	assert.Equal(t, 1, count)
+	count, _ = mocker.ProducerStats("mock:after-block")
+	assert.Equal(t, 0, count)
+}
+
+func TestBlockUntilConsumer(t *testing.T) {
+
+	producing := core.Create()
+	producing.Register(ComponentCreator)
+	component := producing.Register(mock.ComponentCreator)
+	mocker := component.(mock.MockComponent)
+
+	consuming := core.Create()
+	consuming.Register(ComponentCreator)
+	component = consuming.Register(mock.ComponentCreator)
+	collector := component.(mock.MockComponent)
+
+	producing.Add(func(builder core.RouteBuilder) {
+		builder.FromS("mock:start").ToS("direct-vm:late?timeout=5s")
+	})
+	consuming.Add(func(builder core.RouteBuilder) {
+		builder.FromS("direct-vm:late").ToS("mock:out")
+	})
+
+	producing.Start()
+	defer producing.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		mocker.Send("mock:start", core.NewTextMessage("hello"))
+		close(done)
+	}()
+
+	// start the consumer only once the producer is waiting for it
+	assert.Eventually(t, func() bool {
+		return endpoints.waiters("direct-vm:late") == 1
+	}, time.Second, time.Millisecond)
+	consuming.Start()
+	defer consuming.Stop()
+	<-done
+
+	count, _ := collector.ProducerStats("mock:out")
+	assert.Equal(t, 1, count)
+}
+
+func TestDuplicateConsumer(t *testing.T) {
+
+	tenant1 := core.Create()
+	tenant1.Register(ComponentCreator)
+	tenant1.Register(mock.ComponentCreator)
+
+	tenant2 := core.Create()
+	tenant2.Register(ComponentCreator)
+	tenant2.Register(mock.ComponentCreator)
+
+	assert.Nil(t, tenant1.Add(func(builder core.RouteBuilder) {
+		builder.FromS("direct-vm:owned").RouteID("owner").ToS("mock:tenant1")
+	}))
+	assert.Nil(t, tenant2.Add(func(builder core.RouteBuilder) {
+		builder.FromS("direct-vm:owned").RouteID("intruder").ToS("mock:tenant2")
+	}))
+
+	tenant1.Start()
+	defer tenant1.Stop()
+	err := tenant2.StartRoute("intruder")
+	assert.Equal(t, DuplicateConsumer{Endpoint: "direct-vm:owned"}, err)
+	info, _ := tenant2.Route("intruder")
+	assert.Equal(t, core.RouteInitialized, info.Status)
+
+	// the endpoint is still consumed by the first tenant
+	initiator := endpoints.lookup("direct-vm:owned")
+	assert.NotNil(t, initiator)
+	tenant2.Stop()
+	assert.Equal(t, initiator, endpoints.lookup("direct-vm:owned"))
+}
+
+func TestInvalidNoConsumerMode(t *testing.T) {
+
+	context := core.Create()
+	context.Register(ComponentCreator)
+	context.Register(mock.ComponentCreator)
+
+	err := context.Add(func(builder core.RouteBuilder) {
+		builder.FromS("mock:start").ToS("direct-vm:nobody?noConsumer=blok")
+	})
+	assert.Equal(t, InvalidNoConsumerMode{Mode: "blok"}, err)
+	assert.Empty(t, context.Routes())
+}
+
+func TestAwaitTimeout(t *testing.T) {
+
+	assert.Nil(t, endpoints.await("direct-vm:abandoned", time.Millisecond))
+	assert.Equal(t, 0, endpoints.waiters("direct-vm:abandoned"))
+	endpoints.lock.Lock()
+	_, found := endpoints.waiting["direct-vm:abandoned"]
+	endpoints.lock.Unlock()
+	assert.False(t, found)
+}
@@ -0,0 +1,319 @@
+package file
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/guanaco/guancano/core"
+)
+
+const Prefix = "file"
+
+// FileNameOption is the endpoint option naming the file written by the
+// producer when the message has no FileNameHeader.
+const FileNameOption = "fileName"
+
+// FileNameHeader is the message header naming the file written by the
+// producer. The exchange id is used if neither the header nor the
+// FileNameOption is set.
+const FileNameHeader = "fileName"
+
+// PollIntervalOption is the endpoint option that sets how often a polling
+// consumer looks for a new file while it waits. The value is parsed with
+// time.ParseDuration.
+const PollIntervalOption = "pollInterval"
+
+// DefaultPollInterval is how often a polling consumer looks for a new file
+// when no other interval is configured.
+const DefaultPollInterval = 50 * time.Millisecond
+
+func ComponentCreator(ctx core.Context) (core.Component, error) {
+	component := FileComponent{}
+	component.SetPrefix(Prefix)
+	component.SetContext(ctx)
+	return component, nil
+}
+
+// Implementation of a FileComponent. A FileComponent writes the body of
+// messages to files in the directory named by the endpoint path, and
+// reads files from that directory through a polling consumer such as the
+// one used by PollEnrich.
+type FileComponent struct {
+	core.BaseComponent
+}
+
+func (f FileComponent) CreateEndpoint(path string, options map[string]string) core.Endpoint {
+	endpoint := &fileEndpoint{
+		directory:    strings.TrimPrefix(path, f.Prefix()+":"),
+		fileName:     options[FileNameOption],
+		pollInterval: DefaultPollInterval,
+	}
+	if interval, err := time.ParseDuration(options[PollIntervalOption]); err == nil && interval > 0 {
+		endpoint.pollInterval = interval
+	}
+	return endpoint
+}
+
+type fileEndpoint struct {
+	directory    string
+	fileName     string
+	pollInterval time.Duration
+}
+
+func (f *fileEndpoint) CreateConsumer() (core.Consumer, error) {
+	return nil, core.NotAConsumerEndpoint{}
+}
+
+func (f *fileEndpoint) CreatePollingConsumer() (core.PollingConsumer, error) {
+	return &filePollingConsumer{
+		endpoint: f,
+	}, nil
+}
+
+func (f *fileEndpoint) CreateProducer() (core.Producer, error) {
+	return &fileProducer{
+		endpoint: f,
+	}, nil
+}
+
+type fileProducer struct {
+	endpoint *fileEndpoint
+}
+
+func (f *fileProducer) Init() {
+
+}
+
+func (f *fileProducer) Start() {
+
+}
+
+func (f *fileProducer) Stop() {
+
+}
+
+func (f *fileProducer) Close() {
+
+}
+
+// Process writes the body of the in message to the file. When the exchange
+// is part of a transaction the body is written to a temporary file in the
+// same directory that is renamed to the file when the transaction commits
+// and removed when it rolls back.
+func (f *fileProducer) Process(exchange core.Exchange) {
+	fileName := f.fileName(exchange)
+	if !validFileName(fileName) {
+		exchange.SetError(InvalidFileName{Name: fileName})
+		return
+	}
+	name := filepath.Join(f.endpoint.directory, fileName)
+	body, err := content(exchange.In())
+	if err != nil {
+		exchange.SetError(err)
+		return
+	}
+
+	transaction := core.TransactionOf(exchange)
+	if transaction == nil {
+		if err := ioutil.WriteFile(name, body, 0644); err != nil {
+			exchange.SetError(err)
+		}
+		return
+	}
+
+	temp, err := ioutil.TempFile(f.endpoint.directory, "."+filepath.Base(name)+".")
+	if err != nil {
+		exchange.SetError(err)
+		return
+	}
+	_, err = temp.Write(body)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(temp.Name())
+		exchange.SetError(err)
+		return
+	}
+	transaction.Enlist(nil, &pendingFile{temp: temp.Name(), name: name})
+}
+
+func (f *fileProducer) fileName(exchange core.Exchange) string {
+	if headers := exchange.In().Headers(); headers != nil {
+		if name, ok := (*headers)[FileNameHeader]; ok {
+			return fmt.Sprint(name)
+		}
+	}
+	if f.endpoint.fileName != "" {
+		return f.endpoint.fileName
+	}
+	return exchange.Id()
+}
+
+// validFileName reports whether the name is of a file in the directory of
+// the endpoint rather than a path that could lead outside of it
+func validFileName(name string) bool {
+	return name != "" && name != "." &&
+		!strings.ContainsAny(name, `/\`) && !strings.Contains(name, "..")
+}
+
+func content(message core.Message) ([]byte, error) {
+	switch body := message.Body().(type) {
+	case []byte:
+		return body, nil
+	case string:
+		return []byte(body), nil
+	case nil:
+		return []byte{}, nil
+	case fmt.Stringer:
+		return []byte(body.String()), nil
+	default:
+		return nil, UnsupportedBody{Body: body}
+	}
+}
+
+// filePollingConsumer hands out the files of the directory oldest first.
+// Each file is removed once it has been read so that it is only received
+// once, even by consumers of the same directory in other routes.
+type filePollingConsumer struct {
+	endpoint *fileEndpoint
+
+	lock    sync.Mutex
+	stopped chan struct{}
+}
+
+func (f *filePollingConsumer) Init() {
+
+}
+
+func (f *filePollingConsumer) Start() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.stopped = make(chan struct{})
+}
+
+// Stop ends the wait of any Receive that is still waiting for a file
+func (f *filePollingConsumer) Stop() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.stopped != nil {
+		close(f.stopped)
+		f.stopped = nil
+	}
+}
+
+func (f *filePollingConsumer) Close() {
+
+}
+
+// Receive returns the oldest file in the directory as a message with the
+// contents of the file as a []byte body and the name of the file in the
+// FileNameHeader. Hidden files, such as those still being written in a
+// transaction, are skipped.
+func (f *filePollingConsumer) Receive(timeout time.Duration) (core.Message, error) {
+	f.lock.Lock()
+	stopped := f.stopped
+	f.lock.Unlock()
+
+	var deadline <-chan time.Time
+	if timeout >= 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	for {
+		message, err := f.poll()
+		if message != nil || err != nil || timeout == 0 {
+			return message, err
+		}
+		wait := time.NewTimer(f.endpoint.pollInterval)
+		select {
+		case <-wait.C:
+		case <-deadline:
+			wait.Stop()
+			return f.poll()
+		case <-stopped:
+			wait.Stop()
+			return nil, nil
+		}
+	}
+}
+
+// poll reads and removes the oldest file in the directory if there is one
+func (f *filePollingConsumer) poll() (core.Message, error) {
+	infos, err := ioutil.ReadDir(f.endpoint.directory)
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]os.FileInfo, 0, len(infos))
+	for _, info := range infos {
+		if info.Mode().IsRegular() && !strings.HasPrefix(info.Name(), ".") {
+			candidates = append(candidates, info)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].ModTime().Before(candidates[j].ModTime())
+	})
+
+	for _, info := range candidates {
+		name := filepath.Join(f.endpoint.directory, info.Name())
+		body, err := ioutil.ReadFile(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// another consumer received the file if it was already removed
+		if err := os.Remove(name); os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		message := core.NewMessage(body)
+		(*message.Headers())[FileNameHeader] = info.Name()
+		return message, nil
+	}
+	return nil, nil
+}
+
+// pendingFile is the TransactionResource for a file written in a
+// transaction.
+type pendingFile struct {
+	temp string
+	name string
+}
+
+func (p *pendingFile) Commit() error {
+	return os.Rename(p.temp, p.name)
+}
+
+func (p *pendingFile) Rollback() error {
+	return os.Remove(p.temp)
+}
+
+// UnsupportedBody is the error set on an exchange whose body cannot be
+// written to a file.
+type UnsupportedBody struct {
+	Body interface{}
+}
+
+func (u UnsupportedBody) Error() string {
+	return fmt.Sprintf("Cannot write a body of type %T to a file", u.Body)
+}
+
+// InvalidFileName is the error set on an exchange when the name of the file
+// to write contains a path separator or "..".
+type InvalidFileName struct {
+	Name string
+}
+
+func (i InvalidFileName) Error() string {
+	return fmt.Sprintf("The file name %q is not a file in the directory of the Endpoint", i.Name)
+}
@@ -0,0 +1,177 @@
+package file
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/guanaco/guancano/core"
+	"github.com/guanaco/guancano/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "file")
+	assert.Nil(t, err)
+	return dir
+}
+
+func files(t *testing.T, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	names := make([]string, 0)
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names
+}
+
+func TestFileProducer(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	context := core.Create()
+	context.Register(ComponentCreator)
+	component := context.Register(mock.ComponentCreator)
+	mocker := component.(mock.MockComponent)
+
+	context.Add(func(builder core.RouteBuilder) {
+		builder.FromS("mock:named").ToS("file:" + dir + "?fileName=named.txt")
+		builder.FromS("mock:header").ToS("file:" + dir)
+	})
+	context.Start()
+
+	mocker.Send("mock:named", core.NewTextMessage("hello"))
+	message := core.NewTextMessage("world")
+	(*message.Headers())[FileNameHeader] = "header.txt"
+	mocker.Send("mock:header", message)
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "named.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(content))
+	content, err = ioutil.ReadFile(filepath.Join(dir, "header.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "world", string(content))
+}
+
+func TestTransactedFileProducer(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	context := core.Create()
+	context.Register(ComponentCreator)
+	component := context.Register(mock.ComponentCreator)
+	mocker := component.(mock.MockComponent)
+
+	var pending []string
+	context.Add(func(builder core.RouteBuilder) {
+		builder.FromS("mock:commit").
+			Transacted(core.TransactionPolicy{}).
+			ToS("file:" + dir + "?fileName=committed.txt").
+			ProcessFunction(func(exchange core.Exchange) {
+				pending = files(t, dir)
+			}).
+			End()
+		builder.FromS("mock:rollback").
+			Transacted(core.TransactionPolicy{}).
+			ToS("file:" + dir + "?fileName=rolledback.txt").
+			ProcessFunction(func(exchange core.Exchange) {
+				exchange.SetError(errors.New("failed"))
+			}).
+			End()
+	})
+	context.Start()
+
+	mocker.Send("mock:commit", core.NewTextMessage("hello"))
+	assert.Equal(t, 1, len(pending))
+	assert.NotEqual(t, "committed.txt", pending[0])
+	assert.Equal(t, []string{"committed.txt"}, files(t, dir))
+
+	mocker.Send("mock:rollback", core.NewTextMessage("hello"))
+	assert.Equal(t, []string{"committed.txt"}, files(t, dir))
+}
+
+func TestFilePollEnrich(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// the oldest file is received first and files being written in a
+	// transaction are skipped
+	now := time.Now()
+	for idx, name := range []string{"second.txt", "first.txt", ".pending"} {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, ioutil.WriteFile(path, []byte(name), 0644))
+		modified := now.Add(time.Duration(-idx) * time.Minute)
+		assert.Nil(t, os.Chtimes(path, modified, modified))
+	}
+
+	context := core.Create()
+	context.Register(ComponentCreator)
+	component := context.Register(mock.ComponentCreator)
+	mocker := component.(mock.MockComponent)
+
+	received := make([]string, 0)
+	assert.Nil(t, context.Add(func(builder core.RouteBuilder) {
+		builder.FromS("mock:start").
+			PollEnrich("file:"+dir+"?pollInterval=1ms", 10*time.Millisecond, nil).
+			ProcessFunction(func(exchange core.Exchange) {
+				if name, ok := (*exchange.In().Headers())[FileNameHeader]; ok {
+					received = append(received, name.(string)+"="+string(exchange.In().Body().([]byte)))
+				} else {
+					received = append(received, exchange.In().Body().(string))
+				}
+			})
+	}))
+	context.Start()
+	defer context.Stop()
+
+	for idx := 0; idx < 3; idx++ {
+		mocker.Send("mock:start", core.NewTextMessage("empty"))
+	}
+	assert.Equal(t, []string{"first.txt=first.txt", "second.txt=second.txt", "empty"}, received)
+	assert.Equal(t, []string{".pending"}, files(t, dir))
+}
+
+func TestFileProducerInvalidName(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+	assert.Nil(t, os.Mkdir(out, 0755))
+
+	context := core.Create()
+	context.Register(ComponentCreator)
+	component := context.Register(mock.ComponentCreator)
+	mocker := component.(mock.MockComponent)
+
+	failures := make([]error, 0)
+	context.AddEventNotifier(core.EventNotifierFunction(func(event core.Event) {
+		if failed, ok := event.(core.ExchangeFailedEvent); ok {
+			failures = append(failures, failed.Err)
+		}
+	}))
+	context.Add(func(builder core.RouteBuilder) {
+		builder.FromS("mock:header").ToS("file:" + out)
+		builder.FromS("mock:option").ToS("file:" + out + "?fileName=..%2Fescaped.txt")
+	})
+	context.Start()
+
+	names := []string{"../escaped.txt", "sub/file.txt", "..", "", `sub\file.txt`}
+	expected := make([]error, 0)
+	for _, name := range names {
+		message := core.NewTextMessage("hello")
+		(*message.Headers())[FileNameHeader] = name
+		mocker.Send("mock:header", message)
+		expected = append(expected, InvalidFileName{Name: name})
+	}
+
+	// the option is checked the same way as the header
+	mocker.Send("mock:option", core.NewTextMessage("hello"))
+	expected = append(expected, InvalidFileName{Name: "../escaped.txt"})
+
+	assert.Equal(t, expected, failures)
+	assert.Equal(t, []string{"out"}, files(t, dir))
+	assert.Equal(t, []string{}, files(t, out))
+}
@@ -1,15 +1,24 @@
 package mock
 
 import (
+	"sync"
+	"time"
+
 	"github.com/guanaco/guancano/core"
 )
 
 const Prefix = "mock"
 
+// QueueSize is the number of messages that can be offered to a mock
+// endpoint before Offer blocks waiting for a polling consumer.
+const QueueSize = 100
+
 func ComponentCreator(context core.Context) (core.Component, error) {
 	component := MockComponent{
 		consumers: make(map[string]*mockConsumer),
 		producers: make(map[string]*mockProducer),
+		queues:    make(map[string]chan core.Message),
+		lock:      &sync.RWMutex{},
 	}
 	component.SetPrefix(Prefix)
 	component.SetContext(context)
@@ -20,6 +29,8 @@ type MockComponent struct {
 	core.BaseComponent
 	consumers map[string]*mockConsumer
 	producers map[string]*mockProducer
+	queues    map[string]chan core.Message
+	lock      *sync.RWMutex
 }
 
 func (m MockComponent) CreateEndpoint(path string, options map[string]string) core.Endpoint {
@@ -29,33 +40,70 @@ func (m MockComponent) CreateEndpoint(path string, options map[string]string) co
 	}
 }
 
+func (m *MockComponent) consumer(path string) (*mockConsumer, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	consumer, found := m.consumers[path]
+	return consumer, found
+}
+
+func (m *MockComponent) producer(path string) (*mockProducer, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	producer, found := m.producers[path]
+	return producer, found
+}
+
+// Send the message to every route consuming from the mock endpoint. Send
+// can be called from multiple goroutines at the same time.
 func (m *MockComponent) Send(route string, message core.Message) {
-	if consumer, found := m.consumers[route]; found {
-		for idx := 0; idx < len(consumer.initiators); idx++ {
-			exchange := consumer.initiators[idx].Exchange(message)
+	if consumer, found := m.consumer(route); found {
+		for _, initiator := range consumer.started() {
+			exchange := initiator.Exchange(message)
 			if exchange.Pattern() == core.RequestReplyExchange {
-				consumer.responses = append(consumer.responses, exchange.In())
+				consumer.respond(exchange.In())
 			}
 		}
 	}
 }
 
+// Offer queues the message for a polling consumer of the mock endpoint to
+// receive.
+func (m *MockComponent) Offer(path string, message core.Message) {
+	m.queue(path) <- message
+}
+
+func (m *MockComponent) queue(path string) chan core.Message {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	queue, found := m.queues[path]
+	if !found {
+		queue = make(chan core.Message, QueueSize)
+		m.queues[path] = queue
+	}
+	return queue
+}
+
 func (m *MockComponent) ConsumerStats(path string) (int, []core.Message) {
-	if consumer, ok := m.consumers[path]; ok {
+	if consumer, ok := m.consumer(path); ok {
 		if consumer == nil {
 			return 0, nil
 		}
-		return len(consumer.responses), consumer.responses
+		consumer.lock.Lock()
+		defer consumer.lock.Unlock()
+		return len(consumer.responses), append([]core.Message(nil), consumer.responses...)
 	}
 	return 0, nil
 }
 
 func (m *MockComponent) ProducerStats(path string) (int, []core.Message) {
-	if producer, ok := m.producers[path]; ok {
+	if producer, ok := m.producer(path); ok {
 		if producer == nil {
 			return 0, nil
 		}
-		return producer.invocations, producer.messages
+		producer.lock.Lock()
+		defer producer.lock.Unlock()
+		return producer.invocations, append([]core.Message(nil), producer.messages...)
 	}
 	return 0, nil
 }
@@ -65,42 +113,145 @@ type mockEndpoint struct {
 	component *MockComponent
 }
 
+// CreateConsumer returns a consumer for one route. The routes consuming
+// from the same mock endpoint share the initiators and responses of the
+// endpoint.
 func (m *mockEndpoint) CreateConsumer() (core.Consumer, error) {
-	if value, found := m.component.consumers[m.name]; found {
-		return value, nil
+	m.component.lock.Lock()
+	defer m.component.lock.Unlock()
+	consumer, found := m.component.consumers[m.name]
+	if !found {
+		consumer = &mockConsumer{
+			name:      m.name,
+			component: m.component,
+		}
+		m.component.consumers[m.name] = consumer
 	}
-	consumer := &mockConsumer{
-		name:      m.name,
-		component: m.component,
+	return &mockRouteConsumer{consumer: consumer}, nil
+}
+
+// mockRouteConsumer adds the initiator of its route to the endpoint when it
+// is started and removes it again when it is stopped
+type mockRouteConsumer struct {
+	consumer  *mockConsumer
+	initiator core.Initiator
+}
+
+func (m *mockRouteConsumer) Init() {
+
+}
+
+func (m *mockRouteConsumer) Stop() {
+	m.consumer.remove(m.initiator)
+	m.initiator = nil
+}
+
+func (m *mockRouteConsumer) Close() {
+	m.Stop()
+}
+
+func (m *mockRouteConsumer) Start(initiator core.Initiator) {
+	if m.initiator != nil {
+		m.consumer.remove(m.initiator)
 	}
-	m.component.consumers[m.name] = consumer
-	return consumer, nil
+	m.initiator = initiator
+	m.consumer.add(initiator)
 }
 
 type mockConsumer struct {
 	name       string
 	component  *MockComponent
+	lock       sync.Mutex
 	initiators []core.Initiator
 	responses  []core.Message
 }
 
-func (m mockConsumer) Init() {
+func (m *mockConsumer) add(initiator core.Initiator) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, started := range m.initiators {
+		if started == initiator {
+			return
+		}
+	}
+	m.initiators = append(m.initiators, initiator)
+}
+
+func (m *mockConsumer) remove(initiator core.Initiator) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for idx, started := range m.initiators {
+		if started == initiator {
+			m.initiators = append(m.initiators[:idx], m.initiators[idx+1:]...)
+			return
+		}
+	}
+}
+
+func (m *mockConsumer) started() []core.Initiator {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]core.Initiator(nil), m.initiators...)
+}
 
+func (m *mockConsumer) respond(message core.Message) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.responses = append(m.responses, message)
 }
 
-func (m mockConsumer) Stop() {
+func (m *mockEndpoint) CreatePollingConsumer() (core.PollingConsumer, error) {
+	return &mockPollingConsumer{
+		queue: m.component.queue(m.name),
+	}, nil
+}
 
+// mockPollingConsumer receives the messages offered to the mock endpoint
+type mockPollingConsumer struct {
+	queue chan core.Message
 }
 
-func (m mockConsumer) Close() {
+func (m *mockPollingConsumer) Init() {
 
 }
 
-func (m *mockConsumer) Start(initiator core.Initiator) {
-	m.initiators = append(m.initiators, initiator)
+func (m *mockPollingConsumer) Start() {
+
+}
+
+func (m *mockPollingConsumer) Stop() {
+
+}
+
+func (m *mockPollingConsumer) Close() {
+
+}
+
+func (m *mockPollingConsumer) Receive(timeout time.Duration) (core.Message, error) {
+	if timeout < 0 {
+		return <-m.queue, nil
+	}
+	if timeout == 0 {
+		select {
+		case message := <-m.queue:
+			return message, nil
+		default:
+			return nil, nil
+		}
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case message := <-m.queue:
+		return message, nil
+	case <-timer.C:
+		return nil, nil
+	}
 }
 
 func (m *mockEndpoint) CreateProducer() (core.Producer, error) {
+	m.component.lock.Lock()
+	defer m.component.lock.Unlock()
 	if value, found := m.component.producers[m.name]; found {
 		return value, nil
 	}
@@ -119,6 +270,7 @@ func (m *mockEndpoint) CreateProducer() (core.Producer, error) {
 type mockProducer struct {
 	name        string
 	component   *MockComponent
+	lock        sync.Mutex
 	invocations int
 	messages    []core.Message
 }
@@ -140,6 +292,8 @@ func (m *mockProducer) Start() {
 }
 
 func (m *mockProducer) Process(exchange core.Exchange) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
 	m.messages = append(m.messages, exchange.In())
 	m.invocations++
 }
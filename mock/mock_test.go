@@ -3,7 +3,9 @@ package mock
 import (
 	"github.com/stretchr/testify/assert"
 	"github.com/guanaco/guancano/core"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestMock(t *testing.T) {
@@ -80,3 +82,98 @@ func TestInOutMock(t *testing.T) {
 	assert.Equal(t, 1, invocations)
 	assert.Equal(t, 1, len(messages))
 }
+
+func TestConcurrentMock(t *testing.T) {
+
+	context := core.Create()
+
+	component := context.Register(ComponentCreator)
+	mocker := component.(MockComponent)
+
+	context.Add(func(builder core.RouteBuilder) {
+		builder.FromS("mock:start").RequestReply().ToS("mock:test1")
+		builder.FromS("mock:start").ToS("mock:test1")
+	})
+
+	context.Start()
+
+	senders := 8
+	wg := sync.WaitGroup{}
+	for sender := 0; sender < senders; sender++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mocker.Send("mock:start", core.NewTextMessage("test"))
+			mocker.ProducerStats("mock:test1")
+		}()
+	}
+	wg.Wait()
+
+	invocations, messages := mocker.ProducerStats("mock:test1")
+	assert.Equal(t, 2*senders, invocations)
+	assert.Equal(t, 2*senders, len(messages))
+}
+
+func TestPollEnrich(t *testing.T) {
+
+	context := core.Create()
+
+	component := context.Register(ComponentCreator)
+	mocker := component.(MockComponent)
+
+	context.Add(func(builder core.RouteBuilder) {
+		builder.FromS("mock:start").PollEnrich("mock:inbox", 10*time.Millisecond, nil).ToS("mock:out")
+	})
+
+	context.Start()
+
+	mocker.Offer("mock:inbox", core.NewTextMessage("polled"))
+	mocker.Send("mock:start", core.NewTextMessage("trigger"))
+
+	// nothing left to poll so the exchange continues unchanged
+	mocker.Send("mock:start", core.NewTextMessage("trigger"))
+
+	invocations, messages := mocker.ProducerStats("mock:out")
+	assert.Equal(t, 2, invocations)
+	assert.Equal(t, "polled", messages[0].Body())
+	assert.Equal(t, "trigger", messages[1].Body())
+}
+
+func TestMockRouteLifecycle(t *testing.T) {
+
+	context := core.Create()
+
+	component := context.Register(ComponentCreator)
+	mocker := component.(MockComponent)
+
+	assert.Nil(t, context.Add(func(builder core.RouteBuilder) {
+		builder.FromS("mock:start").RouteID("first").ToS("mock:out")
+		builder.FromS("mock:start").RouteID("second").ToS("mock:out")
+	}))
+
+	context.Start()
+
+	// only the running routes receive what is sent
+	assert.Nil(t, context.SuspendRoute("first"))
+	mocker.Send("mock:start", core.NewTextMessage("suspended"))
+	invocations, _ := mocker.ProducerStats("mock:out")
+	assert.Equal(t, 1, invocations)
+
+	// a resumed route receives each message once
+	assert.Nil(t, context.ResumeRoute("first"))
+	mocker.Send("mock:start", core.NewTextMessage("resumed"))
+	invocations, _ = mocker.ProducerStats("mock:out")
+	assert.Equal(t, 3, invocations)
+
+	assert.Nil(t, context.StopRoute("first"))
+	assert.Nil(t, context.StopRoute("second"))
+	mocker.Send("mock:start", core.NewTextMessage("stopped"))
+	invocations, _ = mocker.ProducerStats("mock:out")
+	assert.Equal(t, 3, invocations)
+
+	// a restarted route is added back once
+	assert.Nil(t, context.StartRoute("second"))
+	mocker.Send("mock:start", core.NewTextMessage("restarted"))
+	invocations, _ = mocker.ProducerStats("mock:out")
+	assert.Equal(t, 4, invocations)
+}
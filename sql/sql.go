@@ -0,0 +1,162 @@
+package sql
+
+import (
+	gosql "database/sql"
+	"fmt"
+	"net/url"
+
+	"github.com/guanaco/guancano/core"
+)
+
+const Prefix = "sql"
+
+// StatementOption is the endpoint option holding the statement to execute.
+// The value must be escaped like any other endpoint option so that a ? in
+// the statement is not taken for the start of the options, which
+// StatementUri does.
+const StatementOption = "statement"
+
+// StatementHeader is the message header holding the statement to execute.
+// It takes precedence over the StatementOption of the endpoint.
+const StatementHeader = "sqlStatement"
+
+// ArgsHeader is the message header holding the arguments of the statement
+// as a []interface{}.
+const ArgsHeader = "sqlArgs"
+
+// RowsAffectedHeader is the header the producer sets on the out message to
+// the number of rows the statement changed.
+const RowsAffectedHeader = "sqlRowsAffected"
+
+// ComponentCreator returns a creator for a SqlComponent that executes
+// statements against the database.
+func ComponentCreator(db *gosql.DB) core.ComponentCreator {
+	return func(ctx core.Context) (core.Component, error) {
+		component := SqlComponent{
+			db: db,
+		}
+		component.SetPrefix(Prefix)
+		component.SetContext(ctx)
+		return component, nil
+	}
+}
+
+// StatementUri returns the uri of an endpoint that executes the statement.
+func StatementUri(statement string) string {
+	return Prefix + ":?" + StatementOption + "=" + url.QueryEscape(statement)
+}
+
+// Implementation of a SqlComponent. A SqlComponent executes the statement
+// from the StatementHeader, the StatementOption of the endpoint or else the
+// body of the message, with the arguments from the ArgsHeader. The path of
+// the endpoint is only a name and is not executed, since a ? placeholder in
+// it would be taken for the start of the options. The statement is run in
+// the transaction of a Transacted block if the exchange is in one, with one
+// *sql.Tx per database enlisted in the core.Transaction.
+type SqlComponent struct {
+	core.BaseComponent
+	db *gosql.DB
+}
+
+func (s SqlComponent) CreateEndpoint(path string, options map[string]string) core.Endpoint {
+	return &sqlEndpoint{
+		statement: options[StatementOption],
+		db:        s.db,
+	}
+}
+
+type sqlEndpoint struct {
+	statement string
+	db        *gosql.DB
+}
+
+func (s *sqlEndpoint) CreateConsumer() (core.Consumer, error) {
+	return nil, core.NotAConsumerEndpoint{}
+}
+
+func (s *sqlEndpoint) CreateProducer() (core.Producer, error) {
+	return &sqlProducer{
+		endpoint: s,
+	}, nil
+}
+
+type sqlProducer struct {
+	endpoint *sqlEndpoint
+}
+
+func (s *sqlProducer) Init() {
+
+}
+
+func (s *sqlProducer) Start() {
+
+}
+
+func (s *sqlProducer) Stop() {
+
+}
+
+func (s *sqlProducer) Close() {
+
+}
+
+func (s *sqlProducer) Process(exchange core.Exchange) {
+	statement := s.endpoint.statement
+	var args []interface{}
+	if headers := exchange.In().Headers(); headers != nil {
+		if header, ok := (*headers)[StatementHeader]; ok {
+			statement = fmt.Sprint(header)
+		}
+		args, _ = (*headers)[ArgsHeader].([]interface{})
+	}
+	if statement == "" {
+		statement = fmt.Sprint(exchange.In().Body())
+	}
+
+	executor, err := s.executor(exchange)
+	if err != nil {
+		exchange.SetError(err)
+		return
+	}
+	result, err := executor.Exec(statement, args...)
+	if err != nil {
+		exchange.SetError(err)
+		return
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		exchange.SetError(err)
+		return
+	}
+	out := core.NewMessage(exchange.In().Body())
+	if headers := exchange.In().Headers(); headers != nil {
+		for key, value := range *headers {
+			(*out.Headers())[key] = value
+		}
+	}
+	(*out.Headers())[RowsAffectedHeader] = affected
+	exchange.Out(out)
+}
+
+type executor interface {
+	Exec(query string, args ...interface{}) (gosql.Result, error)
+}
+
+// executor returns the *sql.Tx enlisted for the database in the transaction
+// of the exchange, beginning one if there is none yet, or the database when
+// the exchange is not in a transaction
+func (s *sqlProducer) executor(exchange core.Exchange) (executor, error) {
+	transaction := core.TransactionOf(exchange)
+	if transaction == nil {
+		return s.endpoint.db, nil
+	}
+	if tx, ok := transaction.Resource(s.endpoint.db).(*gosql.Tx); ok {
+		return tx, nil
+	}
+	tx, err := s.endpoint.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	transaction.Enlist(s.endpoint.db, tx)
+	return tx, nil
+}
@@ -0,0 +1,193 @@
+package sql
+
+import (
+	gosql "database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/guanaco/guancano/core"
+	"github.com/guanaco/guancano/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingDriver is a database/sql driver that records the statements it
+// is given and the outcome of the transactions they were executed in.
+type recordingDriver struct {
+	lock sync.Mutex
+	log  []string
+}
+
+func (r *recordingDriver) record(entry string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.log = append(r.log, entry)
+}
+
+func (r *recordingDriver) entries() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string(nil), r.log...)
+}
+
+func (r *recordingDriver) Open(name string) (driver.Conn, error) {
+	return &recordingConn{driver: r}, nil
+}
+
+type recordingConn struct {
+	driver *recordingDriver
+}
+
+func (r *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return &recordingStmt{driver: r.driver, query: query}, nil
+}
+
+func (r *recordingConn) Close() error {
+	return nil
+}
+
+func (r *recordingConn) Begin() (driver.Tx, error) {
+	r.driver.record("begin")
+	return &recordingTx{driver: r.driver}, nil
+}
+
+type recordingTx struct {
+	driver *recordingDriver
+}
+
+func (r *recordingTx) Commit() error {
+	r.driver.record("commit")
+	return nil
+}
+
+func (r *recordingTx) Rollback() error {
+	r.driver.record("rollback")
+	return nil
+}
+
+type recordingStmt struct {
+	driver *recordingDriver
+	query  string
+}
+
+func (r *recordingStmt) Close() error {
+	return nil
+}
+
+func (r *recordingStmt) NumInput() int {
+	return -1
+}
+
+func (r *recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	r.driver.record(fmt.Sprintf("%s %v", r.query, args))
+	return driver.RowsAffected(1), nil
+}
+
+func (r *recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, io.EOF
+}
+
+var drivers = 0
+
+func openRecording(t *testing.T) (*gosql.DB, *recordingDriver) {
+	recording := &recordingDriver{}
+	drivers++
+	name := fmt.Sprintf("recording%d", drivers)
+	gosql.Register(name, recording)
+	db, err := gosql.Open(name, "")
+	assert.Nil(t, err)
+	db.SetMaxOpenConns(1)
+	return db, recording
+}
+
+func TestSqlProducer(t *testing.T) {
+	db, recording := openRecording(t)
+	defer db.Close()
+
+	context := core.Create()
+	context.Register(ComponentCreator(db))
+	component := context.Register(mock.ComponentCreator)
+	mocker := component.(mock.MockComponent)
+
+	context.Add(func(builder core.RouteBuilder) {
+		builder.FromS("mock:in").ToS(StatementUri("insert into orders values (?, :name)")).ToS("mock:out")
+	})
+	context.Start()
+
+	message := core.NewTextMessage("order")
+	(*message.Headers())[ArgsHeader] = []interface{}{int64(1), "order"}
+	mocker.Send("mock:in", message)
+
+	assert.Equal(t, []string{"insert into orders values (?, :name) [1 order]"}, recording.entries())
+	_, messages := mocker.ProducerStats("mock:out")
+	assert.Equal(t, 1, len(messages))
+	assert.Equal(t, int64(1), (*messages[0].Headers())[RowsAffectedHeader])
+}
+
+func TestTransactedSqlProducer(t *testing.T) {
+	db, recording := openRecording(t)
+	defer db.Close()
+
+	context := core.Create()
+	context.Register(ComponentCreator(db))
+	component := context.Register(mock.ComponentCreator)
+	mocker := component.(mock.MockComponent)
+
+	context.Add(func(builder core.RouteBuilder) {
+		builder.FromS("mock:commit").
+			Transacted(core.TransactionPolicy{}).
+			ToS(StatementUri("insert into orders")).
+			ToS(StatementUri("insert into audit")).
+			End()
+		builder.FromS("mock:rollback").
+			Transacted(core.TransactionPolicy{}).
+			ToS(StatementUri("insert into orders")).
+			ProcessFunction(func(exchange core.Exchange) {
+				exchange.SetError(errors.New("failed"))
+			}).
+			End()
+	})
+	context.Start()
+
+	mocker.Send("mock:commit", core.NewTextMessage("order"))
+	assert.Equal(t, []string{"begin", "insert into orders []", "insert into audit []", "commit"}, recording.entries())
+
+	recording.log = nil
+	mocker.Send("mock:rollback", core.NewTextMessage("order"))
+	assert.Equal(t, []string{"begin", "insert into orders []", "rollback"}, recording.entries())
+}
+
+func TestSqlStatementSources(t *testing.T) {
+	db, recording := openRecording(t)
+	defer db.Close()
+
+	context := core.Create()
+	context.Register(ComponentCreator(db))
+	component := context.Register(mock.ComponentCreator)
+	mocker := component.(mock.MockComponent)
+
+	assert.Nil(t, context.Add(func(builder core.RouteBuilder) {
+		builder.FromS("mock:option").ToS("sql:orders?statement=delete+from+orders+where+id+%3D+%3F")
+		builder.FromS("mock:header").ToS(StatementUri("delete from orders"))
+		builder.FromS("mock:body").ToS("sql:orders")
+	}))
+	context.Start()
+
+	message := core.NewTextMessage("ignored")
+	(*message.Headers())[ArgsHeader] = []interface{}{int64(2)}
+	mocker.Send("mock:option", message)
+	message = core.NewTextMessage("ignored")
+	(*message.Headers())[StatementHeader] = "delete from audit where id = ?"
+	(*message.Headers())[ArgsHeader] = []interface{}{int64(3)}
+	mocker.Send("mock:header", message)
+	mocker.Send("mock:body", core.NewTextMessage("delete from orders"))
+
+	assert.Equal(t, []string{
+		"delete from orders where id = ? [2]",
+		"delete from audit where id = ? [3]",
+		"delete from orders []",
+	}, recording.entries())
+}